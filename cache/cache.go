@@ -0,0 +1,334 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Cache stores downloaded artifacts on disk so that they are only fetched
+// once across runs. Entries are keyed by a slash separated path, e.g.
+// "<job>/<build>/prometheus.tar".
+type Cache struct {
+	// Dir is the root directory of the cache
+	Dir string
+
+	// Refresh ignores the existing entries and downloads them again
+	Refresh bool
+
+	// Client is used for the downloads
+	Client *http.Client
+
+	// StallTimeout aborts the downloads that receive no data for that long
+	StallTimeout time.Duration
+}
+
+// entry is stored next to every cached file to validate it
+type entry struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// New creates a Cache rooted at dir. The downloads have no overall timeout,
+// as tarballs can take long to transfer, but they fail on servers that do
+// not answer or stop sending data
+func New(dir string, refresh bool) *Cache {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+
+	return &Cache{
+		Dir:          dir,
+		Refresh:      refresh,
+		Client:       &http.Client{Transport: transport},
+		StallTimeout: time.Minute,
+	}
+}
+
+// Prune removes every entry of the cache
+func (c *Cache) Prune() error {
+	err := os.RemoveAll(c.Dir)
+	if err != nil {
+		return fmt.Errorf("could not prune cache %s: %v", c.Dir, err)
+	}
+	return nil
+}
+
+// Get returns the path of the cached copy of url stored under key. The file
+// is only downloaded if it is not in the cache yet, or if the cache is
+// refreshed: build artifacts do not change, so cached files are served
+// without any request. Interrupted downloads are resumed on the next call,
+// including the ones interrupted by cancelling ctx. Concurrent calls for the
+// same key, from this process or another, download it once.
+func (c *Cache) Get(ctx context.Context, key, url string) (string, error) {
+	path, err := c.path(key)
+	if err != nil {
+		return "", err
+	}
+	if !c.Refresh && c.valid(path, url) {
+		return path, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("could not create cache dir: %v", err)
+	}
+
+	unlock, err := lock(ctx, path+".lock")
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	// Another call may have downloaded it while this one waited for the lock
+	if !c.Refresh && c.valid(path, url) {
+		return path, nil
+	}
+
+	e, err := c.download(ctx, path, url)
+	if err != nil {
+		return "", err
+	}
+
+	// Record the entry once the file is in place; a missing or stale entry
+	// only costs a new download
+	err = writeEntry(path+".json", e)
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// path returns where the entry of key is stored, and fails if key does not
+// resolve to a path inside the cache
+func (c *Cache) path(key string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(key))
+	if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid cache key %q: it must be a relative path inside the cache", key)
+	}
+	return filepath.Join(c.Dir, rel), nil
+}
+
+// valid reports whether the file at path is a complete copy of url
+func (c *Cache) valid(path, url string) bool {
+	e, err := readEntry(path + ".json")
+	if err != nil || e.URL != url {
+		return false
+	}
+
+	f, err := os.Stat(path)
+	return err == nil && f.Size() == e.Size
+}
+
+// lock takes an exclusive lock on the file at path, waiting for other
+// holders until ctx is cancelled. The lock is released by the returned
+// function, or when the process dies
+func lock(ctx context.Context, path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not create lock file: %v", err)
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() { f.Close() }, nil
+		}
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %v", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// download fetches url into path. The data is written to a ".part" file that
+// is renamed to path once complete. If a ".part" file is left over from an
+// interrupted download, only the missing bytes are requested. The download
+// is aborted if no data is received for StallTimeout.
+func (c *Cache) download(ctx context.Context, path, url string) (entry, error) {
+	part := path + ".part"
+	e := entry{URL: url}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return e, err
+	}
+
+	// Resume an interrupted transfer of the same version of the file
+	var offset int64
+	if partial, err := readEntry(part + ".json"); err == nil && partial.URL == url {
+		if f, err := os.Stat(part); err == nil && f.Size() > 0 {
+			offset = f.Size()
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			if partial.ETag != "" {
+				req.Header.Set("If-Range", partial.ETag)
+			}
+		}
+	}
+
+	// Cancelled when the body stalls
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	res, err := c.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return e, err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusOK:
+		// Either a fresh download or the file changed since the
+		// interrupted one: start over
+		offset = 0
+		flags |= os.O_TRUNC
+		e.Size = res.ContentLength
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+		e.Size = totalSize(res.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file can not be resumed, start over
+		res.Body.Close()
+		os.Remove(part)
+		os.Remove(part + ".json")
+		return c.download(ctx, path, url)
+	default:
+		return e, fmt.Errorf("bad status: %s", res.Status)
+	}
+	e.ETag = res.Header.Get("ETag")
+
+	err = writeEntry(part+".json", e)
+	if err != nil {
+		return e, err
+	}
+
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return e, err
+	}
+
+	body := &stallReader{r: res.Body, cancel: cancel}
+	if c.StallTimeout > 0 {
+		body.timeout = c.StallTimeout
+		body.timer = time.AfterFunc(c.StallTimeout, body.stall)
+		defer body.timer.Stop()
+	}
+	written, err := io.Copy(out, body)
+	if body.stalled() {
+		err = fmt.Errorf("no data received for %v", c.StallTimeout)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return e, fmt.Errorf("download of %s interrupted, it will be resumed on the next run: %v", url, err)
+	}
+
+	size := offset + written
+	if e.Size >= 0 && size != e.Size {
+		return e, fmt.Errorf("download of %s is incomplete: got %d bytes, want %d", url, size, e.Size)
+	}
+	e.Size = size
+
+	err = os.Rename(part, path)
+	if err != nil {
+		return e, fmt.Errorf("could not move %s into the cache: %v", url, err)
+	}
+	os.Remove(part + ".json")
+
+	return e, nil
+}
+
+// stallReader reads r, and calls cancel if no data is read for timeout
+type stallReader struct {
+	r       io.Reader
+	cancel  context.CancelFunc
+	timeout time.Duration
+	timer   *time.Timer
+
+	// hasStalled is set once the timeout expired
+	hasStalled int32
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 && s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+func (s *stallReader) stall() {
+	atomic.StoreInt32(&s.hasStalled, 1)
+	s.cancel()
+}
+
+func (s *stallReader) stalled() bool {
+	return atomic.LoadInt32(&s.hasStalled) == 1
+}
+
+// totalSize parses the complete length out of a Content-Range header, e.g.
+// "bytes 100-199/200". It returns -1 if the length is unknown.
+func totalSize(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i == -1 {
+		return -1
+	}
+
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+func readEntry(path string) (entry, error) {
+	var e entry
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+
+	err = json.Unmarshal(data, &e)
+	return e, err
+}
+
+// writeEntry atomically replaces the entry file at path
+func writeEntry(path string, e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write cache entry: %v", err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("could not write cache entry: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	content := bytes.Repeat([]byte("This text represents the binary tarball."), 100)
+
+	var requests []*http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		rw.Header().Set("ETag", `"v1"`)
+		http.ServeContent(rw, req, "prometheus.tar", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(dir, false)
+	key := "job/16/prometheus.tar"
+	url := ts.URL + "/prometheus.tar"
+
+	// Leave behind the first half of an interrupted download
+	part := filepath.Join(dir, "job", "16", "prometheus.tar.part")
+	if err := os.MkdirAll(filepath.Dir(part), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(part, content[:len(content)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEntry(part+".json", entry{URL: url, ETag: `"v1"`, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Resumes interrupted downloads", func(t *testing.T) {
+		path, err := c.Get(context.Background(), key, url)
+		if err != nil {
+			t.Fatalf("while fetching the file: %v", err)
+		}
+
+		if len(requests) != 1 {
+			t.Fatalf("expected 1 request, found %d", len(requests))
+		}
+		if have := requests[0].Header.Get("Range"); have != "bytes=2000-" {
+			t.Errorf("expected to request the missing bytes, found range %q", have)
+		}
+
+		have, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, content) {
+			t.Errorf("expected the cached file to be complete, found %d bytes", len(have))
+		}
+		if _, err := os.Stat(part); !os.IsNotExist(err) {
+			t.Errorf("expected the partial file to be removed")
+		}
+	})
+
+	t.Run("Serves cached files without network", func(t *testing.T) {
+		path, err := c.Get(context.Background(), key, url)
+		if err != nil {
+			t.Fatalf("while fetching the file: %v", err)
+		}
+		if len(requests) != 1 {
+			t.Errorf("expected no new request, found %d requests", len(requests))
+		}
+		if have, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(have, content) {
+			t.Errorf("expected the cached file to be kept, found %d bytes: %v", len(have), err)
+		}
+	})
+
+	t.Run("Downloads again when refreshing", func(t *testing.T) {
+		if _, err := New(dir, true).Get(context.Background(), key, url); err != nil {
+			t.Fatalf("while fetching the file: %v", err)
+		}
+		if len(requests) != 2 {
+			t.Errorf("expected a new request, found %d requests", len(requests))
+		}
+	})
+
+	t.Run("Serves cached files with the server down", func(t *testing.T) {
+		ts.Close()
+		if _, err := c.Get(context.Background(), key, url); err != nil {
+			t.Errorf("expected the cached file to be served, got %v", err)
+		}
+	})
+}
+
+func TestGetConcurrent(t *testing.T) {
+	content := bytes.Repeat([]byte("This text represents the binary tarball."), 1000)
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		// Keep the download in progress while the other calls start
+		time.Sleep(200 * time.Millisecond)
+		http.ServeContent(rw, req, "prometheus.tar", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var path string
+			path, errs[i] = New(dir, false).Get(context.Background(), "job/16/prometheus.tar", ts.URL)
+			if errs[i] == nil {
+				if have, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(have, content) {
+					errs[i] = fmt.Errorf("found %d bytes: %v", len(have), err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("call %d failed: %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected the file to be downloaded once, found %d requests", n)
+	}
+}
+
+func TestGetStalled(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Length", "1000")
+		rw.Write([]byte("partial"))
+		rw.(http.Flusher).Flush()
+		select {
+		case <-done:
+		case <-req.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(dir, false)
+	c.StallTimeout = 100 * time.Millisecond
+	if _, err := c.Get(context.Background(), "job/16/prometheus.tar", ts.URL); err == nil {
+		t.Errorf("expected the stalled download to fail")
+	}
+}
+
+func TestGetInvalidKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(filepath.Join(dir, "cache"), false)
+	for _, key := range [...]string{"", "..", "../escaped", "job/../../escaped", "/etc/passwd"} {
+		if _, err := c.Get(context.Background(), key, "http://127.0.0.1:0/"); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written out of the cache, got %v", err)
+	}
+}
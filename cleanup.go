@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/prometheus"
+)
+
+// pidFile is written in the promData dir of a run while it is in progress. It
+// holds the PID of the run and the name of its host
+const pidFile = "prom-scrape.pid"
+
+func writePIDFile(promDir string) error {
+	host, err := prometheus.Hostname()
+	if err != nil {
+		return err
+	}
+	content := fmt.Sprintf("%d\n%s\n", os.Getpid(), host)
+	err = ioutil.WriteFile(filepath.Join(promDir, pidFile), []byte(content), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write pid file: %v", err)
+	}
+	return nil
+}
+
+func removePIDFile(promDir string) {
+	err := os.Remove(filepath.Join(promDir, pidFile))
+	if err != nil {
+		log.Printf("Could not remove pid file: %v", err)
+	}
+}
+
+// stale reports whether promDir belongs to a run of this host that died. The
+// dirs of finished runs have no pid file, and the runs of other hosts, e.g.
+// on a shared filesystem, can not be checked from here
+func stale(promDir string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(promDir, pidFile))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return true
+	}
+	if len(fields) > 1 {
+		host, err := prometheus.Hostname()
+		if err != nil || fields[1] != host {
+			return false
+		}
+	}
+	pid, err := strconv.Atoi(fields[0])
+	return err != nil || !prometheus.Alive(pid)
+}
+
+// cleanup removes the containers of backendName and the promData dirs left
+// behind by runs that died. The promData of the outDirs are checked on top
+// of the ones recorded by the containers
+func cleanup(backendName string, outDirs []string) error {
+	backend, err := prometheus.NewBackend(backendName, prometheus.Options{})
+	if err != nil {
+		return err
+	}
+
+	promDirs, err := backend.RemoveOrphans(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, dir := range outDirs {
+		promDir, err := filepath.Abs(filepath.Join(dir, "/promData"))
+		if err != nil {
+			return err
+		}
+		promDirs = append(promDirs, promDir)
+	}
+
+	removed := map[string]bool{}
+	for _, promDir := range promDirs {
+		if removed[promDir] || !stale(promDir) {
+			continue
+		}
+
+		log.Printf("Removing %s", promDir)
+		err = os.RemoveAll(promDir)
+		if err != nil {
+			return fmt.Errorf("could not remove %s: %v", promDir, err)
+		}
+		removed[promDir] = true
+	}
+
+	log.Printf("Cleanup done, removed %d promData dirs", len(removed))
+	return nil
+}
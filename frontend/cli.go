@@ -4,17 +4,59 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/urfave/cli"
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	// CommandCleanup is the subcommand removing what crashed runs left behind
+	CommandCleanup = "cleanup"
+
+	// CommandInspect is the subcommand describing the content of a TSDB
+	CommandInspect = "inspect"
+)
+
 // CliApp stores a single instance of the cli
 // and the inputs expected from the user
 type CliApp struct {
 	ConfigPath string
 	DataDir    string
-	App        *cli.App
+	CacheDir   string
+	NoCache    bool
+	PruneCache bool
+
+	// MaxDownloads limits the test runs downloaded and extracted at once
+	MaxDownloads int
+
+	// MaxInstances limits the Prometheus instances running at once
+	MaxInstances int
+
+	// Backend overrides the backend set in the config
+	Backend string
+
+	// BindAddress is where a remote Docker daemon publishes the Prometheus
+	// port
+	BindAddress string
+
+	// StartupTimeout bounds how long a Prometheus instance takes to be ready
+	StartupTimeout time.Duration
+
+	// Command is the subcommand that was run, if any
+	Command string
+
+	// CleanupDirs are the output dirs whose promData the cleanup command
+	// checks, on top of the ones recorded by the containers
+	CleanupDirs []string
+
+	// InspectPath is the TSDB dir or tarball the inspect command describes.
+	// InspectStart and InspectEnd are the time span it must cover, if set
+	InspectPath              string
+	InspectStart, InspectEnd string
+
+	App *cli.App
 }
 
 // NewApp creates and returns a new cli application
@@ -40,9 +82,101 @@ func NewApp() *CliApp {
 			Usage:       "dir used for output and metadata",
 			Destination: &app.DataDir,
 		},
+		cli.StringFlag{
+			Name:        "cache-dir",
+			Usage:       "dir where downloaded artifacts are kept across runs",
+			Value:       defaultCacheDir(),
+			Destination: &app.CacheDir,
+		},
+		cli.BoolFlag{
+			Name:        "no-cache",
+			Usage:       "download the artifacts again instead of reading them from the cache",
+			Destination: &app.NoCache,
+		},
+		cli.BoolFlag{
+			Name:        "prune-cache",
+			Usage:       "empty the cache before running",
+			Destination: &app.PruneCache,
+		},
+		cli.IntFlag{
+			Name:        "max-downloads",
+			Usage:       "maximum number of test runs downloaded and extracted at once",
+			Value:       4,
+			Destination: &app.MaxDownloads,
+		},
+		cli.IntFlag{
+			Name:        "max-instances",
+			Usage:       "maximum number of Prometheus instances running at once",
+			Value:       2,
+			Destination: &app.MaxInstances,
+		},
+		cli.StringFlag{
+			Name:        "backend",
+			Usage:       "runs Prometheus with `BACKEND`: docker, podman or native (default: the backend of the config, or docker)",
+			Destination: &app.Backend,
+		},
+		cli.StringFlag{
+			Name:        "bind-address",
+			Usage:       "publishes the Prometheus API on `ADDRESS` of the host of a remote Docker daemon. Required with a remote daemon; 0.0.0.0 exposes it on every interface. Local daemons always use 127.0.0.1",
+			Destination: &app.BindAddress,
+		},
+		cli.DurationFlag{
+			Name:        "startup-timeout",
+			Usage:       "how long to wait for a Prometheus instance to load the TSDB before giving up on a test run",
+			Value:       5 * time.Minute,
+			Destination: &app.StartupTimeout,
+		},
 	}
 
 	app.App.Action = validateFlags
+	app.App.Commands = []cli.Command{
+		{
+			Name:  CommandCleanup,
+			Usage: "remove the Prometheus containers and the promData dirs left behind by runs that died",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "o, out",
+					Usage: "also check the promData of the output dir `DIR`",
+				},
+				cli.StringFlag{
+					Name:        "backend",
+					Usage:       "looks for the containers of `BACKEND`: docker or podman",
+					Destination: &app.Backend,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				app.Command = CommandCleanup
+				app.CleanupDirs = c.StringSlice("out")
+				return nil
+			},
+		},
+		{
+			Name:      CommandInspect,
+			Usage:     "describe the blocks and the WAL of a TSDB, extracted or not",
+			ArgsUsage: "<TSDB dir or prometheus.tar>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "start",
+					Usage:       "check that the data covers the time span from `TIME`, in RFC3339 (default: the start of the blocks)",
+					Destination: &app.InspectStart,
+				},
+				cli.StringFlag{
+					Name:        "end",
+					Usage:       "check that the data covers the time span until `TIME`, in RFC3339 (default: the end of the blocks)",
+					Destination: &app.InspectEnd,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					cli.ShowCommandHelp(c, CommandInspect)
+					return cli.NewExitError("please pass a TSDB dir or tarball", 2)
+				}
+				app.Command = CommandInspect
+				app.InspectPath = c.Args().First()
+				return nil
+			},
+		},
+	}
 	// Authors
 	emilio := cli.Author{
 		Name:  "Emilio Garcia",
@@ -58,13 +192,24 @@ func NewApp() *CliApp {
 }
 
 func validateFlags(c *cli.Context) error {
-	if c.NumFlags() < 2 {
+	if c.String("config") == "" || c.String("out") == "" {
 		cli.ShowAppHelp(c)
-		return cli.NewExitError("please set both flags", 2)
+		return cli.NewExitError("please set both the config and out flags", 2)
+	}
+	if c.Int("max-downloads") < 1 || c.Int("max-instances") < 1 {
+		return cli.NewExitError("max-downloads and max-instances must be at least 1", 2)
 	}
 	return nil
 }
 
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "prom-scrape")
+}
+
 // ValidateInput checks that the path inputs exist
 func (app *CliApp) ValidateInput() error {
 	err := validPath(app.DataDir)
@@ -90,17 +235,24 @@ func validPath(path string) error {
 	return nil
 }
 
-// ReadInput reads user input data from the cli
-func (app *CliApp) ReadInput() (*DataRequest, error) {
+// Parse parses the command line. Command is set if a subcommand was run
+func (app *CliApp) Parse() error {
 	err := app.App.Run(os.Args)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to run app: %v", err)
+		return fmt.Errorf("Failed to run app: %v", err)
 	}
+	return nil
+}
 
+// ReadInput reads the config file passed on the command line
+func (app *CliApp) ReadInput() (*DataRequest, error) {
 	request, err := readDataRequest(app.ConfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get config: %v", err)
 	}
+	if app.Backend != "" {
+		request.Backend = app.Backend
+	}
 
 	err = request.Validate()
 	if err != nil {
@@ -126,5 +278,13 @@ func readDataRequest(path string) (*DataRequest, error) {
 		return nil, fmt.Errorf("Failed to unmarshal: %v", err)
 	}
 
+	// Top level test IDs are shorthand for a job using the defaults
+	if len(req.TestIDs) > 0 {
+		job := NewJob()
+		job.TestIDs = req.TestIDs
+		req.Jobs = append([]Job{*job}, req.Jobs...)
+		req.TestIDs = nil
+	}
+
 	return req, nil
 }
@@ -3,6 +3,23 @@ package frontend
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/prometheus"
+)
+
+const (
+	// DefaultJobName is the Prow job used when a job does not set one
+	DefaultJobName = "release-openshift-ocp-installer-e2e-openstack-4.3"
+
+	// DefaultBaseURL is the root of the GCS bucket holding the Prow artifacts
+	DefaultBaseURL = "https://gcsweb-ci.svc.ci.openshift.org/gcs/origin-ci-test"
+
+	// DefaultArtifactPath is the location of the Prometheus tarball relative
+	// to the directory of a build
+	DefaultArtifactPath = "artifacts/e2e-openstack/metrics/prometheus.tar"
 )
 
 // DataRequest stores user data requests from CI prom
@@ -11,6 +28,17 @@ type DataRequest struct {
 	// +optional: default: "1m"
 	Step string `yaml:"step,omitempty"`
 
+	// RateWindow is the range of the rates of the queries. It should span
+	// at least 4 scrape intervals
+	// +optional: default: the step
+	RateWindow string `yaml:"rateWindow,omitempty"`
+
+	// QueryTimeout bounds every query sent to Prometheus, and is passed on
+	// as its timeout parameter. It can not be shorter than the
+	// query.timeout of the Prometheus flags
+	// +optional: default: the query.timeout of the Prometheus flags
+	QueryTimeout string `yaml:"queryTimeout,omitempty"`
+
 	// TimeSeries allows you to specify which time series metrics you want to gather
 	// These will get translated to range queries
 
@@ -18,10 +46,322 @@ type DataRequest struct {
 	// "etcd_disk_wal_fsync_duration_seconds_bucket",
 	// "etcd_disk_backend_commit_duration_seconds_bucket",
 	// "etcd_network_peer_round_trip_time_seconds_bucket"]
-	TimeSeries []string `yaml:"promMetrics,omitempty"`
+	TimeSeries []Metric `yaml:"promMetrics,omitempty"`
+
+	// Queries are PromQL queries gathered on top of TimeSeries. A metric
+	// listed in TimeSeries is a shorthand for the default query of its type
+	// +optional
+	Queries []NamedQuery `yaml:"queries,omitempty"`
+
+	// TestIDs holds the UUID of the CI tests you want to pull data from.
+	// They are gathered from the default job; use Jobs to pull from other jobs
+	// +optional
+	TestIDs []string `yaml:"testIDs,omitempty"`
+
+	// Jobs lists the Prow jobs you want to pull data from, each with its own test IDs
+	// +optional
+	Jobs []Job `yaml:"jobs,omitempty"`
+
+	// Sources lists test runs whose Prometheus data is not stored in Prow
+	// +optional
+	Sources []Source `yaml:"sources,omitempty"`
+
+	// Deck selects test runs from the prowjobs listed by Prow Deck
+	// +optional
+	Deck []DeckQuery `yaml:"deck,omitempty"`
+
+	// Backend runs the Prometheus instances: "docker", "podman" or "native".
+	// The --backend flag takes precedence
+	// +optional: default: "docker"
+	Backend string `yaml:"backend,omitempty"`
+
+	// DataMode is how the TSDB gets into the container: "bind" mounts the
+	// local directory, "copy" copies it into a volume, which works with
+	// remote and rootless daemons. Remote daemons require "copy"
+	// +optional: default: "bind"
+	DataMode string `yaml:"dataMode,omitempty"`
+
+	// PrometheusFlags are passed to Prometheus, without their leading
+	// dashes, e.g. `query.timeout: 5m`. They override the defaults; a flag
+	// with an empty value is passed without one, and a default flag is
+	// dropped by prefixing its name with "no-"
+	// +optional
+	PrometheusFlags map[string]string `yaml:"prometheusFlags,omitempty"`
+
+	// PrometheusBinary is the prometheus binary run by the native backend
+	// +optional: default: "prometheus", looked up in PATH
+	PrometheusBinary string `yaml:"prometheusBinary,omitempty"`
+
+	// Image is the Prometheus image run for every test run, instead of the
+	// one picked from Images
+	// +optional
+	Image string `yaml:"image,omitempty"`
+
+	// Images is the compatibility table the image of a test run is picked
+	// from: the first image able to read its TSDB is run
+	// +optional: default: prom/prometheus v2.7.2, then v2.15.2
+	Images []ImageRule `yaml:"images,omitempty"`
+}
+
+// NamedQuery is a PromQL query gathered for every test run
+type NamedQuery struct {
+	// Name is recorded as the metric of the results
+	Name string `yaml:"name"`
+
+	// Query is a Go template of the PromQL query. It can reference
+	// {{.Metric}}, {{.Step}}, {{.RateWindow}}, {{.Quantile}}, {{.Start}} and
+	// {{.End}} in Unix seconds, and {{.Duration}}, the time span queried
+	Query string `yaml:"query"`
+
+	// Metric is the value of {{.Metric}}
+	// +optional
+	Metric string `yaml:"metric,omitempty"`
+
+	// Quantiles are the values of {{.Quantile}}. The query is gathered
+	// once per quantile
+	// +optional: default: gathered once, with {{.Quantile}} set to 0.99
+	Quantiles []float64 `yaml:"quantiles,omitempty"`
+}
+
+// Metric is a metric gathered for every test run, with the default query of
+// its type. In the config, it is either a metric name or a mapping
+type Metric struct {
+	Name string `yaml:"name"`
+
+	// Type is "histogram", "summary", "counter" or "gauge"
+	// +optional: default: read from the metadata of the targets, else
+	// guessed from the _bucket and _total suffixes, else "gauge"
+	Type string `yaml:"type,omitempty"`
+
+	// Query replaces the default query of the type. It is a template, as in
+	// NamedQuery
+	// +optional
+	Query string `yaml:"query,omitempty"`
+
+	// Quantiles are the quantiles of the histogram or summary gathered
+	// +optional: default: [0.99]
+	Quantiles []float64 `yaml:"quantiles,omitempty"`
+}
+
+// ImageRule states the TSDB formats a Prometheus image can read
+type ImageRule struct {
+	Image string `yaml:"image"`
+
+	// MaxMetaVersion is the highest version of the meta.json of the blocks
+	// +optional: default: 1
+	MaxMetaVersion int `yaml:"maxMetaVersion,omitempty"`
+
+	// MaxIndexVersion is the highest format version of the block indexes
+	// +optional: default: 2
+	MaxIndexVersion int `yaml:"maxIndexVersion,omitempty"`
+
+	// LegacyWAL is set if the image reads the WAL written before Prometheus 2.4
+	// +optional
+	LegacyWAL bool `yaml:"legacyWAL,omitempty"`
+
+	// WALCompression is set if the image reads compressed WAL records
+	// +optional
+	WALCompression bool `yaml:"walCompression,omitempty"`
+}
+
+// DeckQuery selects completed prowjobs from a Prow Deck. All the fields that
+// are set must match
+type DeckQuery struct {
+	// URL is the root of Deck, e.g. "https://prow.svc.ci.openshift.org"
+	URL string `yaml:"url"`
+
+	// Job keeps the jobs whose name matches the regex
+	// +optional
+	Job string `yaml:"job,omitempty"`
+
+	// Type keeps the jobs of the given type, e.g. "periodic"
+	// +optional
+	Type string `yaml:"type,omitempty"`
+
+	// State keeps the jobs in the given state, e.g. "failure"
+	// +optional
+	State string `yaml:"state,omitempty"`
+
+	// Since keeps the jobs started within the given duration, e.g. `24h`
+	// +optional
+	Since string `yaml:"since,omitempty"`
+
+	// BaseURL is the root of the GCS bucket the jobs upload their logs to
+	// +optional: default: "https://gcsweb-ci.svc.ci.openshift.org/gcs/origin-ci-test"
+	BaseURL string `yaml:"baseURL,omitempty"`
+
+	// ArtifactPath is the path of the Prometheus tarball relative to the
+	// build directory, as in Job
+	// +optional: default: "artifacts/e2e-openstack/metrics/prometheus.tar"
+	ArtifactPath string `yaml:"artifactPath,omitempty"`
+
+	// JUnitPath is the directory holding the JUnit files, as in Job
+	// +optional
+	JUnitPath string `yaml:"junitPath,omitempty"`
+
+	// Filter skips test runs based on their metadata, as in Job
+	// +optional
+	Filter *Filter `yaml:"filter,omitempty"`
+}
+
+// Source points at the Prometheus data of a single test run outside of Prow.
+// Exactly one of Tarball, Dir, URL and Endpoint must be set
+type Source struct {
+	// Name is recorded as the job of the test run
+	Name string `yaml:"name"`
+
+	// ID is recorded as the test ID of the test run
+	// +optional: default: the base name of the tarball, dir or URL
+	ID string `yaml:"id,omitempty"`
+
+	// Tarball is the path of a prometheus.tar on disk
+	Tarball string `yaml:"tarball,omitempty"`
+
+	// Dir is the path of an extracted TSDB directory
+	Dir string `yaml:"dir,omitempty"`
+
+	// URL is where to download a prometheus.tar from
+	URL string `yaml:"url,omitempty"`
+
+	// Endpoint is a live Prometheus or Thanos to query instead of a TSDB
+	Endpoint *Endpoint `yaml:"endpoint,omitempty"`
+
+	// Start and End bound the queries of the test run
+	// +optional: default: the time span of the TSDB blocks. Required with Endpoint
+	Start time.Time `yaml:"start,omitempty"`
+	End   time.Time `yaml:"end,omitempty"`
+}
+
+// Endpoint is a live Prometheus API, along with how to authenticate to it
+type Endpoint struct {
+	// URL is the root of the Prometheus API, e.g. "https://thanos-querier.example.com"
+	URL string `yaml:"url"`
+
+	// BearerToken, or the content of BearerTokenFile, is sent in the
+	// Authorization header
+	// +optional
+	BearerToken     string `yaml:"bearerToken,omitempty"`
+	BearerTokenFile string `yaml:"bearerTokenFile,omitempty"`
+
+	// BasicAuth authenticates with a username and password
+	// +optional
+	BasicAuth *BasicAuth `yaml:"basicAuth,omitempty"`
+
+	// TLS configures the verification of the server and the client certificate
+	// +optional
+	TLS *TLSConfig `yaml:"tls,omitempty"`
+}
+
+// BasicAuth holds the credentials of basic authentication. The password is
+// either set directly or read from PasswordFile
+type BasicAuth struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"passwordFile,omitempty"`
+}
+
+// TLSConfig configures TLS connections to an endpoint
+type TLSConfig struct {
+	// CAFile verifies the server certificate instead of the system roots
+	CAFile string `yaml:"caFile,omitempty"`
+
+	// CertFile and KeyFile are the client certificate
+	CertFile string `yaml:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile,omitempty"`
+
+	// ServerName overrides the name the server certificate is checked against
+	ServerName string `yaml:"serverName,omitempty"`
+
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// Job stores where the artifacts of a Prow job are found
+type Job struct {
+	// Name of the Prow job
+	// +optional: default: "release-openshift-ocp-installer-e2e-openstack-4.3"
+	Name string `yaml:"name,omitempty"`
+
+	// Type is either "periodic" or "presubmit". The builds of presubmits
+	// are found under the pull request set with Org, Repo and PR
+	// +optional: default: "periodic"
+	Type string `yaml:"type,omitempty"`
+	Org  string `yaml:"org,omitempty"`
+	Repo string `yaml:"repo,omitempty"`
+	PR   int    `yaml:"pr,omitempty"`
+
+	// ProwJob is the URL or path of the prowjob.json of a build. The name,
+	// type and pull request of the job are read from it, and its build is
+	// added to the test IDs
+	// +optional
+	ProwJob string `yaml:"prowJob,omitempty"`
+
+	// BaseURL is the root of the GCS bucket the job uploads its logs to
+	// +optional: default: "https://gcsweb-ci.svc.ci.openshift.org/gcs/origin-ci-test"
+	BaseURL string `yaml:"baseURL,omitempty"`
+
+	// ArtifactPath is the path of the Prometheus tarball relative to the build
+	// directory. It is a Go template; {{.Job}} and {{.ID}} expand to the job
+	// name and the test ID
+	// +optional: default: "artifacts/e2e-openstack/metrics/prometheus.tar"
+	ArtifactPath string `yaml:"artifactPath,omitempty"`
+
+	// JUnitPath is the directory holding the JUnit files, relative to the
+	// build directory, e.g. "artifacts/e2e-openstack/junit". When set, the
+	// metrics are also gathered over the time window of every failed test
+	// +optional
+	JUnitPath string `yaml:"junitPath,omitempty"`
 
 	// TestIDs holds the UUID of the CI tests you want to pull data from
-	TestIDs []string `yaml:"testIDs"`
+	// +optional if Discover is set
+	TestIDs []string `yaml:"testIDs,omitempty"`
+
+	// Discover selects test IDs from the builds listed in the job's bucket.
+	// They are gathered on top of TestIDs
+	// +optional
+	Discover *Discovery `yaml:"discover,omitempty"`
+
+	// Filter skips test runs based on their metadata, before their
+	// Prometheus data is downloaded
+	// +optional
+	Filter *Filter `yaml:"filter,omitempty"`
+}
+
+// Filter selects test runs by their metadata. All the fields that are set
+// must match for a test run to be gathered
+type Filter struct {
+	// Result only keeps the test runs with the given result, e.g. "FAILURE"
+	// +optional
+	Result string `yaml:"result,omitempty"`
+
+	// JobVersion only keeps the test runs whose job version matches the regex
+	// +optional
+	JobVersion string `yaml:"jobVersion,omitempty"`
+
+	// MinDuration only keeps the test runs that lasted at least as long, e.g. `90m`
+	// +optional
+	MinDuration string `yaml:"minDuration,omitempty"`
+}
+
+// Discovery selects builds of a job automatically. At least one of Latest,
+// Since or After must be set; all the ones that are set apply
+type Discovery struct {
+	// Listing is how builds are enumerated: "gcsweb" scrapes the gcsweb
+	// directory listing, "gcs" uses the GCS JSON API
+	// +optional: default: "gcsweb"
+	Listing string `yaml:"listing,omitempty"`
+
+	// Latest selects the N most recent builds
+	// +optional
+	Latest int `yaml:"latest,omitempty"`
+
+	// Since and Until select the builds started between the two dates
+	// +optional
+	Since time.Time `yaml:"since,omitempty"`
+	Until time.Time `yaml:"until,omitempty"`
+
+	// After selects the builds with an ID greater than After
+	// +optional
+	After string `yaml:"after,omitempty"`
 }
 
 // NewDataRequest object and set default values
@@ -29,24 +369,139 @@ func NewDataRequest() *DataRequest {
 	// Set Defaults
 	req := DataRequest{
 		Step: "1m",
-		TimeSeries: []string{
-			"etcd_disk_wal_fsync_duration_seconds_bucket",
-			"etcd_disk_backend_commit_duration_seconds_bucket",
-			"etcd_network_peer_round_trip_time_seconds_bucket",
+		TimeSeries: []Metric{
+			{Name: "etcd_disk_wal_fsync_duration_seconds_bucket"},
+			{Name: "etcd_disk_backend_commit_duration_seconds_bucket"},
+			{Name: "etcd_network_peer_round_trip_time_seconds_bucket"},
 		},
 	}
 
 	return &req
 }
 
+// NewJob creates a Job pointing at the default Prow job
+func NewJob() *Job {
+	return &Job{
+		Name:         DefaultJobName,
+		BaseURL:      DefaultBaseURL,
+		ArtifactPath: DefaultArtifactPath,
+	}
+}
+
+// UnmarshalYAML fills in the default values of the fields a job leaves out
+func (job *Job) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Job
+	j := plain(*NewJob())
+	if err := unmarshal(&j); err != nil {
+		return err
+	}
+	*job = Job(j)
+	return nil
+}
+
+// UnmarshalYAML reads a metric from its name alone, or from a mapping
+func (m *Metric) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*m = Metric{Name: name}
+		return nil
+	}
+
+	type plain Metric
+	var metric plain
+	if err := unmarshal(&metric); err != nil {
+		return err
+	}
+	*m = Metric(metric)
+	return nil
+}
+
+// UnmarshalYAML fills in the default values of the fields a rule leaves out
+func (r *ImageRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ImageRule
+	rule := plain{
+		MaxMetaVersion:  1,
+		MaxIndexVersion: 2,
+	}
+	if err := unmarshal(&rule); err != nil {
+		return err
+	}
+	*r = ImageRule(rule)
+	return nil
+}
+
+// UnmarshalYAML fills in the default values of the fields a query leaves out
+func (q *DeckQuery) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DeckQuery
+	query := plain{
+		BaseURL:      DefaultBaseURL,
+		ArtifactPath: DefaultArtifactPath,
+	}
+	if err := unmarshal(&query); err != nil {
+		return err
+	}
+	*q = DeckQuery(query)
+	return nil
+}
+
 // Validate DataRequest Objects
 func (req *DataRequest) Validate() error {
 	errors := []string{}
 	if req == nil {
 		return fmt.Errorf("nil DataRequest object")
 	}
-	if req.TestIDs == nil || len(req.TestIDs) == 0 {
-		errors = append(errors, "You must specify at least 1 Test ID to gather data from")
+	if len(req.Jobs) == 0 && len(req.Sources) == 0 && len(req.Deck) == 0 {
+		errors = append(errors, "You must specify at least 1 Test ID, source or deck query to gather data from")
+	}
+	for i, job := range req.Jobs {
+		errors = append(errors, job.validate(i)...)
+	}
+	for i, source := range req.Sources {
+		errors = append(errors, source.validate(i)...)
+	}
+	for i, query := range req.Deck {
+		errors = append(errors, query.validate(i)...)
+	}
+	names := map[string]bool{}
+	for i, metric := range req.TimeSeries {
+		if metric.Name == "" {
+			errors = append(errors, fmt.Sprintf("Metric %d: name can not be empty", i))
+		}
+		switch metric.Type {
+		case "", "histogram", "summary", "counter", "gauge":
+		default:
+			errors = append(errors, fmt.Sprintf("Metric %s: invalid type %q: valid types are `histogram`, `summary`, `counter`, `gauge`", metric.Name, metric.Type))
+		}
+		if _, err := template.New("").Parse(metric.Query); err != nil {
+			errors = append(errors, fmt.Sprintf("Metric %s: invalid query: %v", metric.Name, err))
+		}
+		errors = append(errors, validateQuantiles("Metric "+metric.Name, metric.Quantiles)...)
+		names[metric.Name] = true
+	}
+	for i, query := range req.Queries {
+		errors = append(errors, query.validate(i, names)...)
+	}
+	for i, rule := range req.Images {
+		if rule.Image == "" {
+			errors = append(errors, fmt.Sprintf("Image rule %d: image can not be empty", i))
+		}
+	}
+	for name := range req.PrometheusFlags {
+		for _, managed := range prometheus.ManagedFlags {
+			if strings.TrimLeft(name, "-") == managed {
+				errors = append(errors, fmt.Sprintf("Invalid prometheusFlags: %s is set by the backend", name))
+			}
+		}
+	}
+	switch req.DataMode {
+	case "", "bind", "copy":
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid dataMode %q: valid modes are `bind`, `copy`", req.DataMode))
+	}
+	switch req.Backend {
+	case "", "docker", "podman", "native":
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid backend %q: valid backends are `docker`, `podman`, `native`", req.Backend))
 	}
 	if req.Step != "" {
 		ok, err := regexp.MatchString("^\\d+\\w$", req.Step)
@@ -57,14 +512,232 @@ func (req *DataRequest) Validate() error {
 			errors = append(errors, "Invalid Step: Some examples of valid steps are `1m`, `30s`")
 		}
 	}
+	if req.QueryTimeout != "" {
+		errors = append(errors, req.validateQueryTimeout()...)
+	}
+	if req.RateWindow != "" {
+		ok, err := regexp.MatchString("^\\d+\\w$", req.RateWindow)
+		if err != nil {
+			return fmt.Errorf("Regex Error: %v", err)
+		}
+		if !ok {
+			errors = append(errors, "Invalid rateWindow: Some examples of valid windows are `2m`, `5m`")
+		}
+	}
 
 	if len(errors) > 0 {
 		allErrs := "Your config had the following errors:\n"
 		for _, err := range errors {
 			allErrs += fmt.Sprintf("\t%s\n", err)
 		}
-		return fmt.Errorf(allErrs)
+		return fmt.Errorf("%s", allErrs)
 	}
 
 	return nil
 }
+
+// validateQueryTimeout checks that the queries are not given up before
+// Prometheus gives up on them
+func (req *DataRequest) validateQueryTimeout() []string {
+	timeout, err := prometheus.ParseDuration(req.QueryTimeout)
+	if err != nil {
+		return []string{"Invalid queryTimeout: Some examples of valid timeouts are `10m`, `1h`"}
+	}
+	flags := map[string]string{}
+	for name, value := range req.PrometheusFlags {
+		flags[strings.TrimLeft(name, "-")] = value
+	}
+	min, err := prometheus.QueryTimeout(flags)
+	if err != nil {
+		return []string{fmt.Sprintf("Invalid prometheusFlags: query.timeout: %v", err)}
+	}
+	if timeout < min {
+		return []string{fmt.Sprintf("Invalid queryTimeout: %s is shorter than the query.timeout of Prometheus, %v", req.QueryTimeout, min)}
+	}
+	return nil
+}
+
+func (query *NamedQuery) validate(index int, names map[string]bool) []string {
+	errors := []string{}
+	if query.Name == "" {
+		errors = append(errors, fmt.Sprintf("Query %d: name can not be empty", index))
+	} else if names[query.Name] {
+		errors = append(errors, fmt.Sprintf("Query %s: the name is already used", query.Name))
+	}
+	names[query.Name] = true
+
+	if query.Query == "" {
+		errors = append(errors, fmt.Sprintf("Query %s: query can not be empty", query.Name))
+	} else if _, err := template.New("").Parse(query.Query); err != nil {
+		errors = append(errors, fmt.Sprintf("Query %s: invalid query: %v", query.Name, err))
+	}
+	errors = append(errors, validateQuantiles("Query "+query.Name, query.Quantiles)...)
+	return errors
+}
+
+func validateQuantiles(owner string, quantiles []float64) []string {
+	errors := []string{}
+	seen := map[float64]bool{}
+	for _, q := range quantiles {
+		if q <= 0 || q > 1 {
+			errors = append(errors, fmt.Sprintf("%s: invalid quantile %v: quantiles are between 0, excluded, and 1", owner, q))
+		} else if seen[q] {
+			errors = append(errors, fmt.Sprintf("%s: quantile %v is listed twice", owner, q))
+		}
+		seen[q] = true
+	}
+	return errors
+}
+
+func (job *Job) validate(index int) []string {
+	errors := []string{}
+	// Jobs read from a prowjob.json get their name, type and test ID from it
+	if job.ProwJob == "" {
+		errors = append(errors, job.validateLocation(index)...)
+	}
+	if job.BaseURL == "" {
+		errors = append(errors, fmt.Sprintf("Job %s: baseURL can not be empty", job.Name))
+	}
+	if job.ArtifactPath == "" {
+		errors = append(errors, fmt.Sprintf("Job %s: artifactPath can not be empty", job.Name))
+	} else if _, err := template.New("").Parse(job.ArtifactPath); err != nil {
+		errors = append(errors, fmt.Sprintf("Job %s: invalid artifactPath: %v", job.Name, err))
+	}
+	if job.Discover != nil {
+		errors = append(errors, job.Discover.validate(job.Name)...)
+	}
+	if job.Filter != nil {
+		errors = append(errors, job.Filter.validate("Job "+job.Name)...)
+	}
+	return errors
+}
+
+func (job *Job) validateLocation(index int) []string {
+	errors := []string{}
+	if job.Name == "" {
+		errors = append(errors, fmt.Sprintf("Job %d: name can not be empty", index))
+	}
+	switch job.Type {
+	case "", "periodic":
+	case "presubmit":
+		if job.Org == "" || job.Repo == "" || job.PR <= 0 {
+			errors = append(errors, fmt.Sprintf("Job %s: presubmits need org, repo and pr", job.Name))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("Job %s: invalid type %q: valid types are `periodic`, `presubmit`", job.Name, job.Type))
+	}
+	if len(job.TestIDs) == 0 && job.Discover == nil {
+		errors = append(errors, fmt.Sprintf("Job %s: You must specify at least 1 Test ID or a discover section", job.Name))
+	}
+	return errors
+}
+
+func (source *Source) validate(index int) []string {
+	errors := []string{}
+	if source.Name == "" {
+		errors = append(errors, fmt.Sprintf("Source %d: name can not be empty", index))
+	}
+
+	set := 0
+	for _, location := range []string{source.Tarball, source.Dir, source.URL} {
+		if location != "" {
+			set++
+		}
+	}
+	if source.Endpoint != nil {
+		set++
+		errors = append(errors, source.Endpoint.validate(source.Name)...)
+		if source.Start.IsZero() || source.End.IsZero() {
+			errors = append(errors, fmt.Sprintf("Source %s: endpoints need a start and an end", source.Name))
+		}
+	}
+	if set != 1 {
+		errors = append(errors, fmt.Sprintf("Source %s: exactly one of tarball, dir, url or endpoint must be set", source.Name))
+	}
+
+	if !source.Start.IsZero() && !source.End.IsZero() && source.End.Before(source.Start) {
+		errors = append(errors, fmt.Sprintf("Source %s: end is before start", source.Name))
+	}
+	return errors
+}
+
+func (e *Endpoint) validate(sourceName string) []string {
+	errors := []string{}
+	if e.URL == "" {
+		errors = append(errors, fmt.Sprintf("Source %s: endpoint url can not be empty", sourceName))
+	}
+	if (e.BearerToken != "" || e.BearerTokenFile != "") && e.BasicAuth != nil {
+		errors = append(errors, fmt.Sprintf("Source %s: endpoint can not use both a bearer token and basic auth", sourceName))
+	}
+	if e.BasicAuth != nil && e.BasicAuth.Username == "" {
+		errors = append(errors, fmt.Sprintf("Source %s: basicAuth needs a username", sourceName))
+	}
+	if e.TLS != nil && (e.TLS.CertFile == "") != (e.TLS.KeyFile == "") {
+		errors = append(errors, fmt.Sprintf("Source %s: tls needs both certFile and keyFile", sourceName))
+	}
+	return errors
+}
+
+func (q *DeckQuery) validate(index int) []string {
+	errors := []string{}
+	if q.URL == "" {
+		errors = append(errors, fmt.Sprintf("Deck query %d: url can not be empty", index))
+	}
+	if _, err := regexp.Compile(q.Job); err != nil {
+		errors = append(errors, fmt.Sprintf("Deck query %d: invalid job regex: %v", index, err))
+	}
+	if q.Since != "" {
+		if _, err := time.ParseDuration(q.Since); err != nil {
+			errors = append(errors, fmt.Sprintf("Deck query %d: invalid since: %v", index, err))
+		}
+	}
+	if q.BaseURL == "" {
+		errors = append(errors, fmt.Sprintf("Deck query %d: baseURL can not be empty", index))
+	}
+	if _, err := template.New("").Parse(q.ArtifactPath); err != nil || q.ArtifactPath == "" {
+		errors = append(errors, fmt.Sprintf("Deck query %d: invalid artifactPath", index))
+	}
+	if q.Filter != nil {
+		errors = append(errors, q.Filter.validate(fmt.Sprintf("Deck query %d", index))...)
+	}
+	return errors
+}
+
+// validate checks the filter; owner names what the filter belongs to in
+// the errors, e.g. "Job foo"
+func (f *Filter) validate(owner string) []string {
+	errors := []string{}
+	if _, err := regexp.Compile(f.JobVersion); err != nil {
+		errors = append(errors, fmt.Sprintf("%s: invalid jobVersion regex: %v", owner, err))
+	}
+	if f.MinDuration != "" {
+		if _, err := time.ParseDuration(f.MinDuration); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: invalid minDuration: %v", owner, err))
+		}
+	}
+	return errors
+}
+
+func (d *Discovery) validate(jobName string) []string {
+	errors := []string{}
+	switch d.Listing {
+	case "", "gcsweb", "gcs":
+	default:
+		errors = append(errors, fmt.Sprintf("Job %s: invalid listing %q: valid listings are `gcsweb`, `gcs`", jobName, d.Listing))
+	}
+	if d.Latest < 0 {
+		errors = append(errors, fmt.Sprintf("Job %s: latest can not be negative", jobName))
+	}
+	if d.Latest == 0 && d.Since.IsZero() && d.After == "" {
+		errors = append(errors, fmt.Sprintf("Job %s: discover needs at least one of latest, since or after", jobName))
+	}
+	if !d.Since.IsZero() && !d.Until.IsZero() && d.Until.Before(d.Since) {
+		errors = append(errors, fmt.Sprintf("Job %s: until is before since", jobName))
+	}
+	if d.After != "" {
+		if ok, _ := regexp.MatchString("^\\d+$", d.After); !ok {
+			errors = append(errors, fmt.Sprintf("Job %s: after must be a build ID", jobName))
+		}
+	}
+	return errors
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/source"
+	"github.com/shiftstack-dev-tools/prom-dashboard/tsdb"
+)
+
+// inspect prints the content of the TSDB at path, a directory or a tarball.
+// When start or end is set, it also reports how the data fails to cover the
+// time span between them, the missing one defaulting to the span of the
+// blocks, which requires the TSDB to have some. The series, label names and symbols of the blocks are counted from
+// their index, the samples and chunks are the ones recorded in their meta.json
+func inspect(path, start, end string) error {
+	f, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	dir := path
+	if !f.IsDir() {
+		dir, err = ioutil.TempDir("", "prom-scrape-inspect")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		err = source.Untar(context.Background(), dir, path)
+		if err != nil {
+			return fmt.Errorf("couldnt untar file: %v", err)
+		}
+	}
+
+	report, err := tsdb.Inspect(dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BLOCK\tMIN TIME\tMAX TIME\tDURATION\tSERIES\tLABEL NAMES\tSYMBOLS\tSAMPLES\tCHUNKS\tSIZE")
+	for _, block := range report.Blocks {
+		min, max := tsdb.MsToTime(block.MinTime), tsdb.MsToTime(block.MaxTime)
+		series, names, symbols := "?", "?", "?"
+		if block.IndexError == nil {
+			series, names, symbols = fmt.Sprint(block.Index.Series), fmt.Sprint(block.Index.LabelNames), fmt.Sprint(block.Index.Symbols)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\t%s\t%s\t%d\t%d\t%d\n",
+			block.ULID, min, max, max.Sub(min), series, names, symbols,
+			block.Stats.NumSamples, block.Stats.NumChunks, block.Size)
+	}
+	w.Flush()
+
+	for _, block := range report.Blocks {
+		if mismatch := block.Mismatch(); mismatch != "" {
+			fmt.Printf("Block %s: %s\n", block.ULID, mismatch)
+		}
+	}
+
+	fmt.Println()
+	if report.WAL.Segments == 0 {
+		fmt.Println("WAL: none")
+	} else {
+		fmt.Printf("WAL: %d segments, %08d to %08d, %d bytes\n", report.WAL.Segments, report.WAL.First, report.WAL.Last, report.WAL.Size)
+	}
+	if report.WAL.Checkpoint != "" {
+		fmt.Printf("WAL checkpoint: %s\n", report.WAL.Checkpoint)
+	}
+	for _, gap := range report.Gaps() {
+		fmt.Printf("Gap: no block covers %s to %s\n", gap.Start, gap.End)
+	}
+
+	if problem := report.Problem(); problem != "" {
+		fmt.Printf("Unusable: %s\n", problem)
+	}
+
+	if start == "" && end == "" {
+		return nil
+	}
+
+	// A missing bound is the start or the end of the blocks
+	if len(report.Blocks) == 0 {
+		if start == "" {
+			return fmt.Errorf("the TSDB has no blocks to derive the start from, set --start")
+		}
+		if end == "" {
+			return fmt.Errorf("the TSDB has no blocks to derive the end from, set --end")
+		}
+	}
+	startTime, endTime := report.Start(), report.End()
+	if start != "" {
+		startTime, err = time.Parse(time.RFC3339, start)
+		if err != nil {
+			return fmt.Errorf("invalid start: %v", err)
+		}
+	}
+	if end != "" {
+		endTime, err = time.Parse(time.RFC3339, end)
+		if err != nil {
+			return fmt.Errorf("invalid end: %v", err)
+		}
+	}
+	if endTime.Before(startTime) {
+		return fmt.Errorf("the end %s is before the start %s", endTime, startTime)
+	}
+
+	problems := report.Coverage(startTime, endTime)
+	if len(problems) == 0 {
+		fmt.Printf("The data covers %s to %s\n", startTime, endTime)
+	}
+	for _, problem := range problems {
+		fmt.Printf("Coverage: %s\n", problem)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspectWALOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "wal"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "wal", "00000000"), []byte{0x01}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without blocks, the missing bound can not be derived
+	if err := inspect(dir, "2019-10-01T12:00:00Z", ""); err == nil || !strings.Contains(err.Error(), "--end") {
+		t.Errorf("expected to be asked for --end, got %v", err)
+	}
+	if err := inspect(dir, "", "2019-10-01T12:00:00Z"); err == nil || !strings.Contains(err.Error(), "--start") {
+		t.Errorf("expected to be asked for --start, got %v", err)
+	}
+	if err := inspect(dir, "2019-10-01T12:00:00Z", "2019-10-01T13:00:00Z"); err != nil {
+		t.Errorf("expected both bounds to be accepted, got %v", err)
+	}
+}
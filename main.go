@@ -1,246 +1,434 @@
 package main
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"context"
 	"encoding/csv"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
 	"github.com/shiftstack-dev-tools/prom-dashboard/frontend"
 	"github.com/shiftstack-dev-tools/prom-dashboard/prometheus"
 	"github.com/shiftstack-dev-tools/prom-dashboard/prow"
+	"github.com/shiftstack-dev-tools/prom-dashboard/source"
 )
 
 func main() {
 	const (
 		fsyncName         = "fsync"
 		backendCommitName = "backend_commit"
-		baseURL           = "https://gcsweb-ci.svc.ci.openshift.org/gcs/origin-ci-test/logs"
-		jobName           = "release-openshift-ocp-installer-e2e-openstack-4.3"
 	)
 
 	app := frontend.NewApp()
-	err := app.ValidateInput()
+	err := app.Parse()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	switch app.Command {
+	case frontend.CommandCleanup:
+		err = cleanup(app.Backend, app.CleanupDirs)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	case frontend.CommandInspect:
+		err = inspect(app.InspectPath, app.InspectStart, app.InspectEnd)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	err = app.ValidateInput()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 	req, err := app.ReadInput()
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
 
-	// make prom-data dir
+	// make prom-data dir, and record that this process uses it
 	promDir := filepath.Join(app.DataDir, "/promData")
 	os.Mkdir(promDir, os.ModePerm)
+	promDir, err = filepath.Abs(promDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = writePIDFile(promDir)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	// Collect Data
-	flattenedData := [][]string{}
-	for _, id := range req.TestIDs {
-		log.Printf("Preparing test %s", id)
-
-		idDir := filepath.Join(promDir, "/"+id)
-		os.Mkdir(idDir, os.ModePerm)
+	// Tear down on SIGINT and SIGTERM, and give up on the teardown on the
+	// second one. The cleanup command removes the instances left behind
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v, tearing down. Send it again to exit immediately", sig)
+		cancel()
+
+		sig = <-signals
+		log.Printf("Received %v again, exiting without tearing down", sig)
+		os.Exit(1)
+	}()
+
+	// Open the download cache
+	downloads := cache.New(app.CacheDir, app.NoCache)
+	if app.PruneCache {
+		log.Printf("Pruning cache %s", app.CacheDir)
+		err = downloads.Prune()
 		if err != nil {
-			log.Fatalf("couldnt create file: %v", err)
+			log.Fatalln(err)
 		}
+	}
 
-		// Download Metrics
-		data, err := prow.Metrics(baseURL, jobName, id, idDir)
-		if err != nil {
-			log.Fatalf("Failed to get metrics: %v", err)
+	// Gather the sources of the test runs
+	sources := []source.Source{}
+	manifest := Manifest{}
+	for _, job := range req.Jobs {
+		prowJob := prow.Job{
+			Name:         job.Name,
+			Type:         job.Type,
+			Org:          job.Org,
+			Repo:         job.Repo,
+			PR:           job.PR,
+			BaseURL:      job.BaseURL,
+			ArtifactPath: job.ArtifactPath,
 		}
-
-		// Untar prom file
-		promData := filepath.Join(idDir, "/prometheus")
-		os.Mkdir(promData, os.ModePerm)
-		if err != nil {
-			log.Fatalf("couldnt create file: %v", err)
+		testIDs := job.TestIDs
+		if job.ProwJob != "" {
+			pj, err := prow.ReadProwJob(job.ProwJob)
+			if err != nil {
+				log.Fatalf("Failed to read prowjob: %v", err)
+			}
+			if pj.Status.BuildID == "" {
+				log.Fatalf("Prowjob %s has no build ID", job.ProwJob)
+			}
+			prowJob = pj.Job(job.BaseURL, job.ArtifactPath)
+			testIDs = mergeIDs(testIDs, []string{pj.Status.BuildID})
 		}
 
-		tarfile := filepath.Join(idDir, "/prometheus.tar")
+		jobManifest := manifest.job(prowJob.Name)
+		if job.Discover != nil {
+			selector := prow.Selector{
+				Latest: job.Discover.Latest,
+				Since:  job.Discover.Since,
+				Until:  job.Discover.Until,
+				After:  job.Discover.After,
+			}
+			discovered, err := prow.Discover(ctx, downloads, prowJob, job.Discover.Listing, selector)
+			if err != nil {
+				log.Fatalf("Failed to discover builds: %v", err)
+			}
+			log.Printf("Discovered %d builds of job %s", len(discovered), prowJob.Name)
 
-		// If the file is less than 50 Kb, it is definately a dud --> skip data collection
-		// for reference, they are usually upwards of 50 Mb tar'd
-		f, err := os.Stat(tarfile)
+			jobManifest.Discovered = discovered
+			testIDs = mergeIDs(testIDs, discovered)
+		}
+		jobManifest.TestIDs = testIDs
+
+		filter, err := prowFilter(job.Filter)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		if f.Size() < 50000 {
-			log.Printf("Prometheus data from job ID %s is either emtpy or corrupted. Skipping data collection...", id)
 
-			// If no prom data, then just record the start and end time of job and move to next job
-			data := []string{
-				id,
-				"",
-				data.StartedAt.String(),
-				data.FinishedAt.String(),
-				req.Step,
-			}
-			flattenedData = append(flattenedData, data)
-			continue
+		for _, id := range testIDs {
+			sources = append(sources, &source.Prow{Cache: downloads, Job: prowJob, ID: id, Filter: filter, JUnitPath: job.JUnitPath})
 		}
-
-		err = Untar(promData, tarfile)
+	}
+	for _, query := range req.Deck {
+		deckQuery, err := prowDeckQuery(query)
 		if err != nil {
-			log.Fatalf("couldnt untar file: %v", err)
+			log.Fatalln(err)
 		}
 
-		// CHMOD all files in untar'd prom dir to 777
-		cmd := exec.Command("chmod", []string{
-			"-R",
-			"777",
-			promData,
-		}...)
-
-		msg, err := cmd.CombinedOutput()
+		builds, err := prow.NewDeck(query.URL).Builds(deckQuery)
 		if err != nil {
-			log.Fatalf("couldnt chmod prom data: %s: %v", msg, err)
+			log.Fatalf("Failed to query deck %s: %v", query.URL, err)
 		}
+		log.Printf("Found %d builds in deck %s", len(builds), query.URL)
 
-		// Stand up docker container
-		port := "9090"
-		hostpath, err := filepath.Abs(promData)
+		filter, err := prowFilter(query.Filter)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		container, err := prometheus.Up(port, hostpath)
-		if err != nil {
-			log.Fatalf("failed to create docker container: %v", err)
-		}
-
-		for _, metric := range req.TimeSeries {
-			query := prometheus.Query{
-				BaseURL:    fmt.Sprintf("http://localhost:%s", port),
-				MetricName: metric,
-				QueryType:  prometheus.QueryTypeRange,
-				Params: map[string]string{
-					"query": fmt.Sprintf("histogram_quantile(0.99,rate(%s[%s]))", metric, req.Step),
-					"step":  req.Step,
-					"start": data.StartedAt.Format(time.RFC3339),
-					"end":   data.FinishedAt.Format(time.RFC3339),
-				},
-			}
 
-			res, err := query.GetData()
-			if err != nil {
-				log.Fatal(err)
-			}
+		for _, pj := range builds {
+			prowJob := pj.Job(query.BaseURL, query.ArtifactPath)
+			id := pj.Status.BuildID
 
-			vals, err := res.Flatten()
-			if err != nil {
-				log.Fatalf("Failed to flatten %s data: %v\n", query.MetricName, err)
+			jobManifest := manifest.job(prowJob.Name)
+			if hasID(jobManifest.TestIDs, id) {
+				// Already gathered through the jobs
+				continue
 			}
-			for _, val := range vals {
-				data := []string{
-					id,
-					metric,
-					data.StartedAt.String(),
-					data.FinishedAt.String(),
-					req.Step,
-				}
-				data = append(data, val...)
-				flattenedData = append(flattenedData, data)
-			}
-
-			log.Printf("%s gathered for test %s", metric, id)
+			jobManifest.Discovered = append(jobManifest.Discovered, id)
+			jobManifest.TestIDs = append(jobManifest.TestIDs, id)
+			sources = append(sources, &source.Prow{Cache: downloads, Job: prowJob, ID: id, Filter: filter, JUnitPath: query.JUnitPath})
 		}
-		err = prometheus.Down(container)
+	}
+	for _, s := range req.Sources {
+		src, err := localSource(s, downloads)
 		if err != nil {
-			log.Fatalln(err)
+			log.Fatalf("Source %s: %v", s.Name, err)
 		}
+		_, id := src.Name()
+		jobManifest := manifest.job(s.Name)
+		jobManifest.TestIDs = append(jobManifest.TestIDs, id)
+		sources = append(sources, src)
 	}
 
-	// Write the CSV File
-	resFile := filepath.Join(app.DataDir, "/results.csv")
-	file, err := os.Create(resFile)
+	// Collect Data
+	backend, err := prometheus.NewBackend(req.Backend, prometheus.Options{
+		Binary:      req.PrometheusBinary,
+		CopyData:    req.DataMode == "copy",
+		BindAddress: app.BindAddress,
+	})
 	if err != nil {
-		log.Fatalf("Could not write file %s: %v", resFile, err)
+		log.Fatalln(err)
+	}
+	runner, err := newPipeline(promDir, req, backend, app.StartupTimeout, app.MaxDownloads, app.MaxInstances)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	manifest.PrometheusFlags = runner.flags
+	results := runner.run(ctx, sources)
+	removePIDFile(promDir)
+	if ctx.Err() != nil {
+		log.Fatalf("Interrupted: %s", runner.progress.summary())
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	flattenedData, failures, failed := manifest.record(results)
+	log.Printf("Done: %s", runner.progress.summary())
 
-	for _, row := range flattenedData {
-		err := writer.Write(row)
+	// Write the manifest
+	err = manifest.Write(filepath.Join(app.DataDir, "/manifest.json"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Write the CSV Files
+	err = writeCSV(filepath.Join(app.DataDir, "/results.csv"), flattenedData)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(failures) > 0 {
+		err = writeCSV(filepath.Join(app.DataDir, "/failures.csv"), failures)
 		if err != nil {
-			log.Fatalf("Could not write file %s: %v", resFile, err)
+			log.Fatalln(err)
 		}
 	}
+
+	if failed {
+		log.Fatalf("Some test runs failed, see %s", filepath.Join(app.DataDir, "/manifest.json"))
+	}
 }
 
-// Untar takes a destination path and a reader; a tar reader loops over the tarfile
-// creating the file structure at 'dst' along the way, and writing any files
-// Source https://medium.com/@skdomino/taring-untaring-files-in-go-6b07cf56bc07
-func Untar(dst, src string) error {
-	file, err := os.Open(src)
+// writeCSV writes rows to the CSV file at path
+func writeCSV(path string, rows [][]string) error {
+	file, err := os.Create(path)
 	if err != nil {
-		return err
+		return fmt.Errorf("Could not write file %s: %v", path, err)
 	}
 	defer file.Close()
 
-	gzr, err := gzip.NewReader(file)
+	writer := csv.NewWriter(file)
+	err = writer.WriteAll(rows)
 	if err != nil {
-		return err
+		return fmt.Errorf("Could not write file %s: %v", path, err)
 	}
-	defer gzr.Close()
-
-	tr := tar.NewReader(gzr)
+	return nil
+}
 
-	for {
-		header, err := tr.Next()
+// trimFlags strips the leading dashes of the names of the flags in the config
+func trimFlags(flags map[string]string) map[string]string {
+	trimmed := map[string]string{}
+	for name, value := range flags {
+		trimmed[strings.TrimLeft(name, "-")] = value
+	}
+	return trimmed
+}
 
-		switch {
+// imageRules converts the compatibility table of the config
+func imageRules(rules []frontend.ImageRule) []prometheus.ImageRule {
+	converted := make([]prometheus.ImageRule, len(rules))
+	for i, rule := range rules {
+		converted[i] = prometheus.ImageRule{
+			Image:           rule.Image,
+			MaxMetaVersion:  rule.MaxMetaVersion,
+			MaxIndexVersion: rule.MaxIndexVersion,
+			LegacyWAL:       rule.LegacyWAL,
+			WALCompression:  rule.WALCompression,
+		}
+	}
+	return converted
+}
 
-		// if no more files are found return
-		case err == io.EOF:
-			return nil
+// prowFilter converts the filter of a job config into a prow.Filter
+func prowFilter(f *frontend.Filter) (prow.Filter, error) {
+	filter := prow.Filter{}
+	if f == nil {
+		return filter, nil
+	}
 
-		// return any other error
-		case err != nil:
-			return err
+	filter.Result = f.Result
+	if f.JobVersion != "" {
+		re, err := regexp.Compile(f.JobVersion)
+		if err != nil {
+			return filter, fmt.Errorf("invalid jobVersion filter: %v", err)
+		}
+		filter.JobVersion = re
+	}
+	if f.MinDuration != "" {
+		d, err := time.ParseDuration(f.MinDuration)
+		if err != nil {
+			return filter, fmt.Errorf("invalid minDuration filter: %v", err)
+		}
+		filter.MinDuration = d
+	}
+	return filter, nil
+}
 
-		// if the header is nil, just skip it (not sure how this happens)
-		case header == nil:
-			continue
+// prowDeckQuery converts a deck query config into a prow.DeckQuery
+func prowDeckQuery(q frontend.DeckQuery) (prow.DeckQuery, error) {
+	query := prow.DeckQuery{
+		Type:  q.Type,
+		State: q.State,
+	}
+	if q.Job != "" {
+		re, err := regexp.Compile(q.Job)
+		if err != nil {
+			return query, fmt.Errorf("invalid deck job regex: %v", err)
 		}
+		query.Job = re
+	}
+	if q.Since != "" {
+		d, err := time.ParseDuration(q.Since)
+		if err != nil {
+			return query, fmt.Errorf("invalid deck since: %v", err)
+		}
+		query.Since = time.Now().Add(-d)
+	}
+	return query, nil
+}
 
-		// the target location where the dir/file should be created
-		target := filepath.Join(dst, header.Name)
+// localSource converts a source config into the matching source.Source
+func localSource(s frontend.Source, downloads *cache.Cache) (source.Source, error) {
+	id := s.ID
+	switch {
+	case s.Tarball != "":
+		if id == "" {
+			id = filepath.Base(s.Tarball)
+		}
+		return &source.Tarball{Job: s.Name, ID: id, Path: s.Tarball, Start: s.Start, End: s.End}, nil
+	case s.Dir != "":
+		if id == "" {
+			id = filepath.Base(s.Dir)
+		}
+		return &source.Dir{Job: s.Name, ID: id, Path: s.Dir, Start: s.Start, End: s.End}, nil
+	case s.Endpoint != nil:
+		if id == "" {
+			id = s.Start.UTC().Format("20060102T150405Z")
+		}
+		client, err := prometheus.NewClient(clientConfig(s.Endpoint))
+		if err != nil {
+			return nil, err
+		}
+		return &source.Endpoint{Job: s.Name, ID: id, URL: s.Endpoint.URL, Client: client, Start: s.Start, End: s.End}, nil
+	default:
+		if id == "" {
+			id = path.Base(s.URL)
+		}
+		return &source.URL{Cache: downloads, Job: s.Name, ID: id, URL: s.URL, Start: s.Start, End: s.End}, nil
+	}
+}
 
-		// the following switch could also be done using fi.Mode(), not sure if there
-		// a benefit of using one vs. the other.
-		// fi := header.FileInfo()
+// clientConfig converts the credentials of an endpoint of the config
+func clientConfig(e *frontend.Endpoint) prometheus.ClientConfig {
+	cfg := prometheus.ClientConfig{
+		BearerToken:     e.BearerToken,
+		BearerTokenFile: e.BearerTokenFile,
+	}
+	if e.BasicAuth != nil {
+		cfg.Username = e.BasicAuth.Username
+		cfg.Password = e.BasicAuth.Password
+		cfg.PasswordFile = e.BasicAuth.PasswordFile
+	}
+	if e.TLS != nil {
+		cfg.CAFile = e.TLS.CAFile
+		cfg.CertFile = e.TLS.CertFile
+		cfg.KeyFile = e.TLS.KeyFile
+		cfg.ServerName = e.TLS.ServerName
+		cfg.InsecureSkipVerify = e.TLS.InsecureSkipVerify
+	}
+	return cfg
+}
 
-		// check the file type
-		switch header.Typeflag {
+// runColumns returns the leading columns of the results.csv rows of a test run
+func runColumns(jobName, id, metric, quantile, step string, data prow.MetricsData) []string {
+	return []string{
+		jobName,
+		id,
+		metric,
+		quantile,
+		data.StartedAt.String(),
+		data.FinishedAt.String(),
+		step,
+		data.Result,
+		strconv.FormatBool(data.Passed),
+		data.JobVersion,
+		data.Payload,
+		data.WorkNamespace,
+		data.BaseRef,
+		data.BaseSHA,
+		prNumber(data.PR),
+		data.PRSHA,
+		data.Author,
+	}
+}
 
-		// if its a dir and it doesn't exist create it
-		case tar.TypeDir:
-			if _, err := os.Stat(target); err != nil {
-				if err := os.MkdirAll(target, 0755); err != nil {
-					return err
-				}
-			}
+// prNumber formats the pull request number of a test run, leaving it empty
+// for runs that did not test a pull request
+func prNumber(pr int) string {
+	if pr == 0 {
+		return ""
+	}
+	return strconv.Itoa(pr)
+}
 
-		// if it's a file create it
-		case tar.TypeReg:
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				return err
-			}
+// hasID reports whether id is in ids
+func hasID(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
 
-			// copy over contents
-			if _, err := io.Copy(f, tr); err != nil {
-				return err
+// mergeIDs appends the IDs of extra that are not already in ids
+func mergeIDs(ids, extra []string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, list := range [][]string{ids, extra} {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				merged = append(merged, id)
 			}
-
-			// manually close here after each file operation; defering would cause each file close
-			// to wait until all operations have completed.
-			f.Close()
 		}
 	}
+	return merged
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Manifest records which test runs went into the results of a run
+type Manifest struct {
+	// PrometheusFlags are the flags every Prometheus instance ran with, on
+	// top of the ones the backend sets
+	PrometheusFlags []string `json:"prometheusFlags"`
+
+	Jobs []JobManifest `json:"jobs"`
+}
+
+// JobManifest records the test IDs gathered from a single job
+type JobManifest struct {
+	Name       string   `json:"name"`
+	TestIDs    []string `json:"testIDs"`
+	Discovered []string `json:"discovered,omitempty"`
+
+	// Skipped maps the test IDs missing from the results to the reason why
+	Skipped map[string]string `json:"skipped,omitempty"`
+
+	// Failed maps the test IDs that could not be processed to the error
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// job returns the entry of the job named name, adding it if needed
+func (m *Manifest) job(name string) *JobManifest {
+	for i := range m.Jobs {
+		if m.Jobs[i].Name == name {
+			return &m.Jobs[i]
+		}
+	}
+	m.Jobs = append(m.Jobs, JobManifest{Name: name})
+	return &m.Jobs[len(m.Jobs)-1]
+}
+
+func (jm *JobManifest) skip(id, reason string) {
+	if jm.Skipped == nil {
+		jm.Skipped = map[string]string{}
+	}
+	jm.Skipped[id] = reason
+}
+
+// record adds the failed and skipped runs of results to the manifest, and
+// returns the rows of results.csv and failures.csv in the order of results.
+// failed is set if any run failed
+func (m *Manifest) record(results []runResult) (rows, failures [][]string, failed bool) {
+	rows, failures = [][]string{}, [][]string{}
+	for _, res := range results {
+		switch {
+		case res.err != nil:
+			m.job(res.job).fail(res.id, res.err)
+			failed = true
+		case res.skipped != "":
+			m.job(res.job).skip(res.id, res.skipped)
+		}
+		rows = append(rows, res.rows...)
+		failures = append(failures, res.failures...)
+	}
+	return rows, failures, failed
+}
+
+// Write stores the manifest as JSON in path
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode manifest: %v", err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write manifest %s: %v", path, err)
+	}
+	return nil
+}
+
+func (jm *JobManifest) fail(id string, err error) {
+	if jm.Failed == nil {
+		jm.Failed = map[string]string{}
+	}
+	jm.Failed[id] = err.Error()
+}
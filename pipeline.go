@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/frontend"
+	"github.com/shiftstack-dev-tools/prom-dashboard/prometheus"
+	"github.com/shiftstack-dev-tools/prom-dashboard/prow"
+	"github.com/shiftstack-dev-tools/prom-dashboard/source"
+	"github.com/shiftstack-dev-tools/prom-dashboard/tsdb"
+)
+
+// logTailLines is how many lines of the logs of an instance that failed to
+// start are shown in the error
+const logTailLines = 20
+
+// pipeline processes test runs concurrently: while some runs are being
+// downloaded and extracted, others are queried. The number of simultaneous
+// downloads and of live Prometheus instances are limited separately. A run
+// keeps its download slot until it gets an instance, so that at most
+// maxDownloads extracted TSDBs wait on disk
+type pipeline struct {
+	promDir string
+	req     *frontend.DataRequest
+	backend prometheus.Backend
+
+	// startupTimeout bounds how long an instance takes to be ready
+	startupTimeout time.Duration
+
+	// images is the compatibility table the image of every run is picked from
+	images []prometheus.ImageRule
+
+	// flags are passed to every Prometheus instance
+	flags []string
+
+	// metrics and queries are gathered for every test run
+	metrics []metricSpec
+	queries []metricQuery
+
+	// rateWindow is the range of the rates of the queries
+	rateWindow string
+
+	// queryTimeout bounds every request to the Prometheus API
+	queryTimeout time.Duration
+
+	// warned holds the series whose rate window was found too short, so
+	// that it is only reported once
+	warned sync.Map
+
+	// downloads holds a token for every download in progress
+	downloads chan struct{}
+
+	// instances holds a token for every live Prometheus instance
+	instances chan struct{}
+
+	progress progress
+}
+
+// runResult is the outcome of processing a single test run
+type runResult struct {
+	job, id string
+
+	// rows are the results.csv rows of the run
+	rows [][]string
+
+	// failures are the failures.csv rows of the run
+	failures [][]string
+
+	// skipped is why the run has no data in the results, if it has none
+	skipped string
+
+	err error
+}
+
+func newPipeline(promDir string, req *frontend.DataRequest, backend prometheus.Backend, startupTimeout time.Duration, maxDownloads, maxInstances int) (*pipeline, error) {
+	metrics, queries, err := buildQueries(req)
+	if err != nil {
+		return nil, err
+	}
+
+	p := pipeline{
+		promDir:        promDir,
+		req:            req,
+		backend:        backend,
+		startupTimeout: startupTimeout,
+		images:         prometheus.DefaultImages,
+		flags:          prometheus.Flags(trimFlags(req.PrometheusFlags)),
+		metrics:        metrics,
+		queries:        queries,
+		rateWindow:     req.RateWindow,
+		downloads:      make(chan struct{}, maxDownloads),
+		instances:      make(chan struct{}, maxInstances),
+	}
+	if len(req.Images) > 0 {
+		p.images = imageRules(req.Images)
+	}
+	if p.rateWindow == "" {
+		p.rateWindow = req.Step
+	}
+	if req.QueryTimeout != "" {
+		p.queryTimeout, err = prometheus.ParseDuration(req.QueryTimeout)
+	} else {
+		p.queryTimeout, err = prometheus.QueryTimeout(trimFlags(req.PrometheusFlags))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid query timeout: %v", err)
+	}
+	return &p, nil
+}
+
+// run processes all the sources and returns their results in the same order.
+// Once ctx is cancelled, the runs that have not started fail, and the live
+// instances are torn down
+func (p *pipeline) run(ctx context.Context, sources []source.Source) []runResult {
+	results := make([]runResult, len(sources))
+	p.progress.total = len(sources)
+
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src source.Source) {
+			defer wg.Done()
+			results[i] = p.process(ctx, src)
+			p.progress.record(results[i])
+		}(i, src)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// process fetches the data of a single test run and queries it. The
+// extracted data is removed once done
+func (p *pipeline) process(ctx context.Context, src source.Source) runResult {
+	jobName, id := src.Name()
+	res := runResult{job: jobName, id: id}
+
+	idDir := filepath.Join(p.promDir, "/"+jobName, "/"+id)
+	err := os.MkdirAll(idDir, os.ModePerm)
+	if err != nil {
+		res.err = fmt.Errorf("couldnt create file: %v", err)
+		return res
+	}
+	defer func() {
+		if err := source.Cleanup(idDir); err != nil {
+			log.Printf("Could not remove the data of test %s: %v", id, err)
+		}
+	}()
+
+	// Fetch Metrics. The download slot is held until the extracted data
+	// is served by an instance
+	if !acquire(ctx, p.downloads) {
+		res.err = ctx.Err()
+		return res
+	}
+	downloading := true
+	defer func() {
+		if downloading {
+			<-p.downloads
+		}
+	}()
+	log.Printf("Preparing test %s of job %s", id, jobName)
+	run, err := src.Fetch(ctx, idDir)
+
+	if skipped, ok := err.(*prow.SkipError); ok {
+		log.Printf("Skipping test %s of job %s: %s", id, jobName, skipped.Reason)
+		res.skipped = skipped.Reason
+		return res
+	}
+	if noData, ok := err.(*source.NoDataError); ok {
+		log.Printf("Prometheus data from job ID %s is unusable: %s. Skipping data collection...", id, noData.Reason)
+		res.skipped = noData.Reason
+
+		// If no prom data, then just record the start and end time of job
+		res.rows = [][]string{runColumns(jobName, id, "", "", p.req.Step, run.MetricsData)}
+		return res
+	}
+	if err != nil {
+		res.err = fmt.Errorf("Failed to get metrics: %v", err)
+		return res
+	}
+
+	// Live endpoints are queried as they are
+	if run.URL != "" {
+		res.rows, res.failures, res.err = p.gather(ctx, jobName, id, run, run.URL, run.Client)
+		return res
+	}
+
+	// Wait for a free Prometheus slot
+	if !acquire(ctx, p.instances) {
+		res.err = ctx.Err()
+		return res
+	}
+	defer func() { <-p.instances }()
+	<-p.downloads
+	downloading = false
+
+	res.rows, res.failures, res.err = p.query(ctx, jobName, id, idDir, run)
+	return res
+}
+
+// acquire takes a token of the semaphore sem, unless ctx is cancelled first
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// query stands up a Prometheus instance to serve the data of run, and
+// gathers the requested time series from it. The logs of an instance that
+// fails to start are written to idDir
+func (p *pipeline) query(ctx context.Context, jobName, id, idDir string, run source.Run) (rows, failures [][]string, err error) {
+	// Stand up Prometheus
+	hostpath, err := filepath.Abs(run.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	image, err := p.image(run.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	instance, err := p.backend.Up(ctx, prometheus.Spec{
+		DataPath: hostpath,
+		Image:    image,
+		DataDir:  p.promDir,
+		Flags:    p.flags,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start Prometheus: %v", err)
+	}
+	defer func() {
+		if downErr := p.backend.Down(instance); err == nil {
+			err = downErr
+		}
+	}()
+
+	err = prometheus.WaitReady(ctx, p.backend, instance, p.startupTimeout)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, p.startupError(instance, idDir, err)
+	}
+
+	return p.gather(ctx, jobName, id, run, instance.URL, nil)
+}
+
+// gather queries the Prometheus API at baseURL for the requested time series,
+// over the whole run and over the window of every failed test
+func (p *pipeline) gather(ctx context.Context, jobName, id string, run source.Run, baseURL string, client *http.Client) (rows, failures [][]string, err error) {
+	data := run.MetricsData
+
+	queries, err := resolveQueries(p.metrics, p.queries, p.metadata(ctx, id, baseURL, client))
+	if err != nil {
+		return nil, nil, err
+	}
+	p.checkRateWindow(ctx, id, baseURL, client, queries, data.StartedAt, data.FinishedAt)
+
+	for _, q := range queries {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		query, err := p.rangeQuery(baseURL, client, q, data.StartedAt, data.FinishedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res, err := query.GetData(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		vals, err := res.Flatten()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to flatten %s data: %v", query.MetricName, err)
+		}
+		for _, val := range vals {
+			row := runColumns(jobName, id, q.name, q.quantileColumn(), p.req.Step, data)
+			row = append(row, val...)
+			rows = append(rows, row)
+		}
+
+		if q.quantile != 0 {
+			log.Printf("%s (%s) gathered for test %s", q.name, q.quantileColumn(), id)
+		} else {
+			log.Printf("%s gathered for test %s", q.name, id)
+		}
+	}
+
+	for _, test := range run.Tests {
+		if !test.Failed {
+			continue
+		}
+
+		// Without timing information, the test could have failed at any
+		// point of the run
+		start, end := test.Start, test.Start.Add(test.Duration)
+		if start.IsZero() {
+			start, end = data.StartedAt, data.FinishedAt
+		}
+
+		for _, q := range queries {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			query, err := p.rangeQuery(baseURL, client, q, start, end)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			res, err := query.GetData(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			max := ""
+			if v, ok := res.Max(); ok {
+				max = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+			failures = append(failures, []string{
+				jobName,
+				id,
+				test.Suite,
+				test.Name,
+				start.String(),
+				end.String(),
+				q.name,
+				q.quantileColumn(),
+				max,
+			})
+		}
+	}
+
+	return rows, failures, nil
+}
+
+// metadata returns the metadata of the metrics scraped by the Prometheus at
+// baseURL. Instances serving a TSDB scrape nothing, and older ones have no
+// metadata API: the metrics are then classified by their name
+func (p *pipeline) metadata(ctx context.Context, id, baseURL string, client *http.Client) map[string][]prometheus.Metadata {
+	ctx, cancel := context.WithTimeout(ctx, p.queryTimeout)
+	defer cancel()
+	metadata, _, err := prometheus.NewAPI(baseURL, client).Metadata(ctx, "")
+	if err != nil {
+		if apiErr, ok := err.(*prometheus.APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+			log.Printf("Could not read the metadata for test %s, classifying the metrics by name: %v", id, err)
+		}
+		return nil
+	}
+	return metadata
+}
+
+// checkRateWindow warns when the rate window spans less than 4 scrape
+// intervals of the series rated by queries: their rates are then noisy, or
+// empty when the window holds a single sample
+func (p *pipeline) checkRateWindow(ctx context.Context, id, baseURL string, client *http.Client, queries []metricQuery, start, end time.Time) {
+	window, err := prometheus.ParseDuration(p.rateWindow)
+	if err != nil {
+		return
+	}
+
+	api := prometheus.NewAPI(baseURL, client)
+	checked := map[string]bool{}
+	for _, q := range queries {
+		if q.metric == "" || checked[q.metric] || !strings.Contains(q.tmpl.Root.String(), ".RateWindow") {
+			continue
+		}
+		checked[q.metric] = true
+		if _, done := p.warned.Load(q.metric); done {
+			continue
+		}
+
+		interval, err := p.scrapeInterval(ctx, api, q.metric, start.Add(end.Sub(start)/2))
+		if err != nil {
+			log.Printf("Could not detect the scrape interval of %s for test %s: %v", q.metric, id, err)
+			continue
+		}
+		if interval == 0 || window >= 4*interval {
+			continue
+		}
+		if _, done := p.warned.LoadOrStore(q.metric, true); !done {
+			log.Printf("The rate window %s is less than 4 times the scrape interval of %s, %v, in test %s: set rateWindow to at least %v", p.rateWindow, q.metric, interval, id, 4*interval)
+		}
+	}
+}
+
+// scrapeInterval estimates the scrape interval of metric at t, within the
+// query timeout
+func (p *pipeline) scrapeInterval(ctx context.Context, api *prometheus.API, metric string, t time.Time) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.queryTimeout)
+	defer cancel()
+	return prometheus.ScrapeInterval(ctx, api, metric, t)
+}
+
+// image picks the Prometheus image able to read the TSDB in dataDir, unless
+// the config forces one. The native backend runs no image
+func (p *pipeline) image(dataDir string) (string, error) {
+	if p.req.Backend == prometheus.BackendNative {
+		return "", nil
+	}
+	if p.req.Image != "" {
+		return p.req.Image, nil
+	}
+
+	features, err := tsdb.DetectFeatures(dataDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect the TSDB: %v", err)
+	}
+	image, err := prometheus.SelectImage(p.images, features)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Using %s for %s", image, dataDir)
+	return image, nil
+}
+
+// startupError saves the logs of an instance that failed to start to idDir,
+// and adds their tail to err
+func (p *pipeline) startupError(instance prometheus.Instance, idDir string, err error) error {
+	logs, logsErr := p.backend.Logs(instance)
+	if logsErr != nil {
+		return fmt.Errorf("%v (could not get the logs: %v)", err, logsErr)
+	}
+
+	logPath := filepath.Join(idDir, "/prometheus.log")
+	if writeErr := ioutil.WriteFile(logPath, logs, 0644); writeErr != nil {
+		log.Printf("Could not write %s: %v", logPath, writeErr)
+	}
+
+	return fmt.Errorf("%v, logs in %s end with:\n%s", err, logPath, prometheus.Tail(logs, logTailLines))
+}
+
+// rangeQuery builds the query of q between start and end
+func (p *pipeline) rangeQuery(baseURL string, client *http.Client, q metricQuery, start, end time.Time) (prometheus.Query, error) {
+	vars := prometheus.NewQueryVars(q.metric, p.req.Step, p.rateWindow, q.quantileVar(), start, end)
+	expr, err := prometheus.RenderQuery(q.tmpl, vars)
+	if err != nil {
+		return prometheus.Query{}, err
+	}
+
+	return prometheus.Query{
+		BaseURL:    baseURL,
+		Client:     client,
+		MetricName: q.name,
+		QueryType:  prometheus.QueryTypeRange,
+		Expr:       expr,
+		Range:      prometheus.Range{Start: start, End: end, Step: p.req.Step},
+		Timeout:    p.queryTimeout,
+	}, nil
+}
+
+// progress counts the processed test runs
+type progress struct {
+	sync.Mutex
+	total, done, skipped, failed int
+}
+
+func (p *progress) record(res runResult) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.done++
+	switch {
+	case res.err != nil:
+		p.failed++
+		log.Printf("Test %s of job %s failed: %v", res.id, res.job, res.err)
+	case res.skipped != "":
+		p.skipped++
+	}
+	log.Printf("Progress: %s", p.summary())
+}
+
+func (p *progress) summary() string {
+	return fmt.Sprintf("%d/%d test runs processed, %d skipped, %d failed", p.done, p.total, p.skipped, p.failed)
+}
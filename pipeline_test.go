@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/frontend"
+	"github.com/shiftstack-dev-tools/prom-dashboard/prometheus"
+	"github.com/shiftstack-dev-tools/prom-dashboard/prow"
+	"github.com/shiftstack-dev-tools/prom-dashboard/source"
+)
+
+// extracted counts the TSDBs extracted by fakeSource and not yet served by
+// fakeBackend
+type extracted struct {
+	sync.Mutex
+	current, max int
+}
+
+func (e *extracted) add(n int) {
+	e.Lock()
+	defer e.Unlock()
+	e.current += n
+	if e.current > e.max {
+		e.max = e.current
+	}
+}
+
+// fakeSource extracts an empty TSDB after delay, or fails with err
+type fakeSource struct {
+	id        string
+	delay     time.Duration
+	err       error
+	extracted *extracted
+}
+
+func (s *fakeSource) Name() (string, string) {
+	return "job", s.id
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, dir string) (source.Run, error) {
+	time.Sleep(s.delay)
+	run := source.Run{DataDir: filepath.Join(dir, "prometheus")}
+	run.StartedAt = time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	run.FinishedAt = run.StartedAt.Add(time.Hour)
+	if s.err != nil {
+		return run, s.err
+	}
+	if err := os.MkdirAll(run.DataDir, os.ModePerm); err != nil {
+		return run, err
+	}
+	s.extracted.add(1)
+	return run, nil
+}
+
+// fakeBackend serves every instance from the same API server
+type fakeBackend struct {
+	url       string
+	extracted *extracted
+
+	sync.Mutex
+	up, down int
+}
+
+func (b *fakeBackend) Up(ctx context.Context, spec prometheus.Spec) (prometheus.Instance, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.up++
+	return prometheus.Instance{ID: fmt.Sprint(b.up), URL: b.url}, nil
+}
+
+func (b *fakeBackend) Down(instance prometheus.Instance) error {
+	b.Lock()
+	defer b.Unlock()
+	b.down++
+	b.extracted.add(-1)
+	return nil
+}
+
+func (b *fakeBackend) Logs(instance prometheus.Instance) ([]byte, error) {
+	return nil, nil
+}
+
+func (b *fakeBackend) Exited(ctx context.Context, instance prometheus.Instance) error {
+	return nil
+}
+
+func (b *fakeBackend) RemoveOrphans(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func TestPipeline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/-/ready":
+		case "/api/v1/query_range":
+			// Keep the instances busy while other runs are extracted
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprint(rw, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"pod":"etcd-0"},"values":[[1569931200,"0.25"]]}]}}`)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ext := &extracted{}
+	backend := &fakeBackend{url: ts.URL, extracted: ext}
+	req := frontend.NewDataRequest()
+	req.TimeSeries = []frontend.Metric{{Name: "etcd_object_counts"}}
+	req.Image = "prom/prometheus"
+
+	const maxDownloads, maxInstances = 1, 1
+	p, err := newPipeline(dir, req, backend, time.Minute, maxDownloads, maxInstances)
+	if err != nil {
+		t.Fatalf("while creating the pipeline: %v", err)
+	}
+
+	// The first runs take the longest to fetch, yet the results keep the
+	// order of the sources
+	sources := []source.Source{
+		&fakeSource{id: "1", delay: 30 * time.Millisecond, extracted: ext},
+		&fakeSource{id: "2", err: &prow.SkipError{Reason: "passed"}, extracted: ext},
+		&fakeSource{id: "3", err: &source.NoDataError{Reason: "empty TSDB"}, extracted: ext},
+		&fakeSource{id: "4", err: errors.New("download failed"), extracted: ext},
+	}
+	for i := 5; i < 10; i++ {
+		sources = append(sources, &fakeSource{id: fmt.Sprint(i), extracted: ext})
+	}
+	results := p.run(context.Background(), sources)
+
+	for i, res := range results {
+		if _, id := sources[i].Name(); res.id != id {
+			t.Fatalf("expected result %d to be test %s, got %s", i, id, res.id)
+		}
+	}
+	if results[0].err != nil || len(results[0].rows) != 1 {
+		t.Errorf("expected test 1 to be gathered, got %d rows: %v", len(results[0].rows), results[0].err)
+	}
+	if results[1].skipped != "passed" || len(results[1].rows) != 0 {
+		t.Errorf("expected test 2 to be skipped without rows, got %+v", results[1])
+	}
+	if results[2].skipped != "empty TSDB" || len(results[2].rows) != 1 {
+		t.Errorf("expected test 3 to be skipped with the row of the run, got %+v", results[2])
+	}
+	if results[3].err == nil {
+		t.Errorf("expected test 4 to fail")
+	}
+
+	if backend.up != 6 || backend.down != backend.up {
+		t.Errorf("expected 6 instances to be started and torn down, got %d up and %d down", backend.up, backend.down)
+	}
+	if ext.max > maxDownloads+maxInstances {
+		t.Errorf("expected at most %d TSDBs extracted at once, found %d", maxDownloads+maxInstances, ext.max)
+	}
+	if entries, err := ioutil.ReadDir(filepath.Join(dir, "job", "5")); err != nil || len(entries) != 0 {
+		t.Errorf("expected the extracted data to be removed, found %d entries: %v", len(entries), err)
+	}
+
+	var manifest Manifest
+	rows, _, failed := manifest.record(results)
+	if !failed {
+		t.Errorf("expected the failure to be reported")
+	}
+	if len(rows) != 7 {
+		t.Errorf("expected 7 rows, got %d", len(rows))
+	}
+	job := manifest.job("job")
+	if len(job.Skipped) != 2 || job.Failed["4"] == "" || len(job.Failed) != 1 {
+		t.Errorf("unexpected manifest: %+v", job)
+	}
+}
+
+func TestPipelineCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ext := &extracted{}
+	backend := &fakeBackend{extracted: ext}
+	req := frontend.NewDataRequest()
+	req.Image = "prom/prometheus"
+	p, err := newPipeline(dir, req, backend, time.Minute, 1, 1)
+	if err != nil {
+		t.Fatalf("while creating the pipeline: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := p.run(ctx, []source.Source{&fakeSource{id: "1", extracted: ext}})
+	if results[0].err != context.Canceled {
+		t.Errorf("expected the run to be cancelled, got %v", results[0].err)
+	}
+	if backend.up != 0 {
+		t.Errorf("expected no instance to be started, got %d", backend.up)
+	}
+}
@@ -0,0 +1,238 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxGETLength is the longest encoded query sent in a URL. Longer ones are
+// sent as a form, which proxies and servers do not truncate
+const maxGETLength = 2048
+
+// API is a client of the Prometheus HTTP API, version 1
+type API struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Range is the time span and resolution of a range query
+type Range struct {
+	Start, End time.Time
+
+	// Step is a duration, like 30s, or a number of seconds
+	Step string
+}
+
+// Warnings are returned by Prometheus along with the data, e.g. when some
+// Thanos store could not be reached
+type Warnings []string
+
+// APIError is an error returned by Prometheus
+type APIError struct {
+	StatusCode int
+
+	// Type is the errorType of the response, like bad_data or timeout. It is
+	// empty if the response is not from the API
+	Type string
+	Msg  string
+}
+
+func (e *APIError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("error %d: %s", e.StatusCode, e.Msg)
+	}
+	return fmt.Sprintf("error %d (%s): %s", e.StatusCode, e.Type, e.Msg)
+}
+
+// Temporary tells whether the same request may succeed later
+func (e *APIError) Temporary() bool {
+	switch e.Type {
+	case "timeout", "canceled", "unavailable":
+		return true
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Metadata describes a metric, as exposed by the targets
+type Metadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// InstantResult holds the raw prometheus data from an instant query
+type InstantResult struct {
+	Data resultList `json:"data"`
+}
+
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  Warnings        `json:"warnings"`
+}
+
+// NewAPI returns a client of the API at baseURL. A nil client makes the
+// requests with no credentials. The requests are bounded by their context
+// only, as queries over a whole test run can take minutes
+func NewAPI(baseURL string, client *http.Client) *API {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &API{BaseURL: strings.TrimSuffix(baseURL, "/"), Client: client}
+}
+
+// Query evaluates query at ts, or at the time of the server if ts is zero
+func (a *API) Query(ctx context.Context, query string, ts time.Time) (*InstantResult, Warnings, error) {
+	params := url.Values{"query": {query}}
+	setTime(params, "time", ts)
+	setTimeout(ctx, params)
+
+	var result InstantResult
+	warnings, err := a.do(ctx, "query", params, true, &result.Data)
+	if err != nil {
+		return nil, warnings, err
+	}
+	return &result, warnings, nil
+}
+
+// QueryRange evaluates query over r
+func (a *API) QueryRange(ctx context.Context, query string, r Range) (*RangeResult, Warnings, error) {
+	params := url.Values{"query": {query}, "step": {r.Step}}
+	setTime(params, "start", r.Start)
+	setTime(params, "end", r.End)
+	setTimeout(ctx, params)
+
+	result := RangeResult{Success: "success"}
+	warnings, err := a.do(ctx, "query_range", params, true, &result.Data)
+	if err != nil {
+		return nil, warnings, err
+	}
+	return &result, warnings, nil
+}
+
+// Series returns the label sets of the series matching any of matches
+// between start and end. Zero times leave the span open
+func (a *API) Series(ctx context.Context, matches []string, start, end time.Time) ([]map[string]string, Warnings, error) {
+	params := url.Values{"match[]": matches}
+	setTime(params, "start", start)
+	setTime(params, "end", end)
+
+	var result []map[string]string
+	warnings, err := a.do(ctx, "series", params, true, &result)
+	return result, warnings, err
+}
+
+// Labels returns the label names found between start and end
+func (a *API) Labels(ctx context.Context, start, end time.Time) ([]string, Warnings, error) {
+	params := url.Values{}
+	setTime(params, "start", start)
+	setTime(params, "end", end)
+
+	var result []string
+	warnings, err := a.do(ctx, "labels", params, false, &result)
+	return result, warnings, err
+}
+
+// LabelValues returns the values of label found between start and end
+func (a *API) LabelValues(ctx context.Context, label string, start, end time.Time) ([]string, Warnings, error) {
+	params := url.Values{}
+	setTime(params, "start", start)
+	setTime(params, "end", end)
+
+	var result []string
+	warnings, err := a.do(ctx, "label/"+url.PathEscape(label)+"/values", params, false, &result)
+	return result, warnings, err
+}
+
+// Metadata returns the metadata of metric, or of every metric if it is
+// empty. Prometheus only serves it from v2.15.0
+func (a *API) Metadata(ctx context.Context, metric string) (map[string][]Metadata, Warnings, error) {
+	params := url.Values{}
+	if metric != "" {
+		params.Set("metric", metric)
+	}
+
+	var result map[string][]Metadata
+	warnings, err := a.do(ctx, "metadata", params, false, &result)
+	return result, warnings, err
+}
+
+// do calls endpoint and decodes the data of the response into result. The
+// endpoints accepting forms get long queries with POST
+func (a *API) do(ctx context.Context, endpoint string, params url.Values, post bool, result interface{}) (Warnings, error) {
+	u := a.BaseURL + "/api/v1/" + endpoint
+	encoded := params.Encode()
+
+	var req *http.Request
+	var err error
+	if post && len(encoded) > maxGETLength {
+		req, err = http.NewRequest(http.MethodPost, u, strings.NewReader(encoded))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		if encoded != "" {
+			u += "?" + encoded
+		}
+		req, err = http.NewRequest(http.MethodGet, u, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := a.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("http %s error: %v", req.Method, err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the response: %v", err)
+	}
+
+	var apiRes apiResponse
+	if err := json.Unmarshal(body, &apiRes); err != nil {
+		if res.StatusCode/100 != 2 {
+			return nil, &APIError{StatusCode: res.StatusCode, Msg: strings.TrimSpace(string(body))}
+		}
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if apiRes.Status != "success" || res.StatusCode/100 != 2 {
+		return apiRes.Warnings, &APIError{StatusCode: res.StatusCode, Type: apiRes.ErrorType, Msg: apiRes.Error}
+	}
+
+	if err := json.Unmarshal(apiRes.Data, result); err != nil {
+		return apiRes.Warnings, fmt.Errorf("invalid %s data: %v", endpoint, err)
+	}
+	return apiRes.Warnings, nil
+}
+
+// setTime sets param to t in Unix seconds, unless t is zero
+func setTime(params url.Values, param string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	params.Set(param, strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64))
+}
+
+// setTimeout passes the deadline of ctx on, so that Prometheus gives up on
+// the evaluation when the client does
+func setTimeout(ctx context.Context, params url.Values) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	if timeout := time.Until(deadline); timeout > 0 {
+		params.Set("timeout", strconv.FormatFloat(timeout.Seconds(), 'f', 3, 64))
+	}
+}
@@ -0,0 +1,94 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIQueryRange(t *testing.T) {
+	var method, query string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		method, query = req.Method, req.FormValue("query")
+		fmt.Fprint(rw, `{"status":"success","warnings":["partial response"],"data":{"resultType":"matrix","result":[{"metric":{"pod":"etcd-member-master-0"},"values":[[1569931200,"0.25"]]}]}}`)
+	}))
+	defer ts.Close()
+
+	api := NewAPI(ts.URL, nil)
+	r := Range{Start: time.Unix(1569931200, 0), End: time.Unix(1569931260, 0), Step: "30s"}
+	for _, tc := range []struct {
+		name, query, method string
+	}{
+		{"short", `sum(rate(x{job="etcd",code=~"5.+"}[5m]))`, http.MethodGet},
+		{"long", "up + " + strings.Repeat("up + ", maxGETLength/5) + "up", http.MethodPost},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, warnings, err := api.QueryRange(context.Background(), tc.query, r)
+			if err != nil {
+				t.Fatalf("while querying: %v", err)
+			}
+			if method != tc.method {
+				t.Errorf("expected a %s, got a %s", tc.method, method)
+			}
+			if query != tc.query {
+				t.Errorf("the server got %q", query)
+			}
+			if len(warnings) != 1 || warnings[0] != "partial response" {
+				t.Errorf("unexpected warnings: %v", warnings)
+			}
+			if len(res.Data.Result) != 1 || res.Data.Result[0].Metric["pod"] != "etcd-member-master-0" {
+				t.Errorf("unexpected result: %+v", res.Data)
+			}
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v1/query":
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(rw, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+		default:
+			http.Error(rw, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	api := NewAPI(ts.URL, nil)
+	_, _, err := api.Query(context.Background(), "rate(", time.Time{})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Type != "bad_data" || apiErr.Msg != "parse error" || apiErr.Temporary() {
+		t.Errorf("unexpected error: %#v", err)
+	}
+
+	_, _, err = api.Labels(context.Background(), time.Time{}, time.Time{})
+	apiErr, ok = err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadGateway || !apiErr.Temporary() {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
+
+func TestAPILabelValues(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		fmt.Fprint(rw, `{"status":"success","data":["etcd","kubelet"]}`)
+	}))
+	defer ts.Close()
+
+	values, _, err := NewAPI(ts.URL+"/", nil).LabelValues(context.Background(), "job", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("while querying: %v", err)
+	}
+	if path != "/api/v1/label/job/values" {
+		t.Errorf("unexpected path %s", path)
+	}
+	if len(values) != 2 || values[0] != "etcd" {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
@@ -0,0 +1,63 @@
+package prometheus
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "01A", "chunks"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "01A", "chunks", "000001"), []byte("chunk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := tarDir(dir, "data", nobody, nobody)
+	defer archive.Close()
+
+	have := map[string]string{}
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("while reading the archive: %v", err)
+		}
+		if hdr.Uid != nobody || hdr.Gid != nobody {
+			t.Errorf("expected %s to be owned by %d, got %d:%d", hdr.Name, nobody, hdr.Uid, hdr.Gid)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have[hdr.Name] = string(content)
+	}
+
+	want := map[string]string{
+		"data/":                  "",
+		"data/01A/":              "",
+		"data/01A/chunks/":       "",
+		"data/01A/chunks/000001": "chunk",
+	}
+	if len(have) != len(want) {
+		t.Fatalf("expected entries %v, got %v", want, have)
+	}
+	for name, content := range want {
+		if have[name] != content {
+			t.Errorf("expected %s to hold %q, got %q", name, content, have[name])
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+const (
+	// BackendDocker runs Prometheus in a container of the Docker daemon
+	BackendDocker = "docker"
+
+	// BackendPodman runs Prometheus in a container through the Podman socket
+	BackendPodman = "podman"
+
+	// BackendNative runs a local prometheus binary
+	BackendNative = "native"
+
+	// LabelManaged marks the containers created by this tool
+	LabelManaged = "prom-scrape.managed"
+
+	// LabelPID is the process ID of the run that created a container
+	LabelPID = "prom-scrape.pid"
+
+	// LabelHost is the host name of the run that created a container. Only
+	// the processes of the same host can tell whether the run is alive
+	LabelHost = "prom-scrape.host"
+
+	// LabelDataDir is the promData directory of the run that created a
+	// container
+	LabelDataDir = "prom-scrape.data-dir"
+)
+
+// Backend stands up Prometheus instances serving a TSDB directory
+type Backend interface {
+	// Up starts an instance as described by spec, on a free port of
+	// localhost. Cancelling ctx aborts the startup
+	Up(ctx context.Context, spec Spec) (Instance, error)
+
+	// Down stops and removes the instance. It runs to completion even
+	// after the startup context is cancelled
+	Down(instance Instance) error
+
+	// Logs returns the stdout and stderr of the instance
+	Logs(instance Instance) ([]byte, error)
+
+	// Exited returns why the instance stopped running, or nil while it
+	// runs or if the backend can not tell
+	Exited(ctx context.Context, instance Instance) error
+
+	// RemoveOrphans removes the instances left behind by runs that are no
+	// longer alive, and returns the promData directories of these runs
+	RemoveOrphans(ctx context.Context) ([]string, error)
+}
+
+// Spec describes a Prometheus instance
+type Spec struct {
+	// DataPath is the TSDB directory served by the instance
+	DataPath string
+
+	// Image is the Prometheus image run by the container backends
+	Image string
+
+	// DataDir is the promData directory of the run, recorded so that the
+	// instance can be cleaned up if the run dies
+	DataDir string
+
+	// Flags are passed to Prometheus on top of the ManagedFlags
+	Flags []string
+}
+
+// Instance is a running Prometheus
+type Instance struct {
+	// ID identifies the instance within its backend
+	ID string
+
+	// URL is where the Prometheus API is served, e.g. "http://127.0.0.1:41234"
+	URL string
+
+	// volume holds the TSDB copied into a container
+	volume string
+}
+
+// Options configure the backends
+type Options struct {
+	// Binary is the prometheus binary run by the native backend
+	Binary string
+
+	// CopyData makes the container backends copy the TSDB into a volume
+	// instead of bind-mounting it
+	CopyData bool
+
+	// BindAddress is where a remote daemon publishes the Prometheus port
+	BindAddress string
+}
+
+// NewBackend returns the backend called name
+func NewBackend(name string, opts Options) (Backend, error) {
+	switch name {
+	case "", BackendDocker:
+		return &Docker{CopyData: opts.CopyData, BindAddress: opts.BindAddress}, nil
+	case BackendPodman:
+		podman := NewPodman()
+		podman.CopyData = opts.CopyData
+		podman.BindAddress = opts.BindAddress
+		return podman, nil
+	case BackendNative:
+		return NewNative(opts.Binary), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+}
+
+// freePort returns a port of localhost that nothing listens on. Another
+// process may take it before the caller binds it: the container backends let
+// the daemon pick the port instead
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	return port, err
+}
+
+// Hostname returns the name of this host, as recorded with the PIDs
+func Hostname() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("could not read the host name: %v", err)
+	}
+	return host, nil
+}
+
+// Alive reports whether the process pid runs on this host
+func Alive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,118 @@
+package prometheus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ClientConfig holds the credentials and TLS settings used to reach a
+// Prometheus or Thanos endpoint
+type ClientConfig struct {
+	// BearerToken, or the content of BearerTokenFile, is sent in the
+	// Authorization header
+	BearerToken     string
+	BearerTokenFile string
+
+	// Username and Password, or the content of PasswordFile, are sent as
+	// basic auth
+	Username     string
+	Password     string
+	PasswordFile string
+
+	// CAFile verifies the server certificate instead of the system roots
+	CAFile string
+
+	// CertFile and KeyFile are the client certificate
+	CertFile, KeyFile string
+
+	// ServerName overrides the name the server certificate is checked against
+	ServerName string
+
+	InsecureSkipVerify bool
+}
+
+// NewClient returns an HTTP client authenticating as set in cfg. Like the
+// clients of NewAPI, it sets no timeout: the requests are bounded by their
+// context
+func NewClient(cfg ClientConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	auth := &authTransport{next: transport}
+
+	switch {
+	case cfg.BearerToken != "" || cfg.BearerTokenFile != "":
+		token, err := secret(cfg.BearerToken, cfg.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.header = "Bearer " + token
+	case cfg.Username != "":
+		password, err := secret(cfg.Password, cfg.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.username, auth.password = cfg.Username, password
+	}
+
+	return &http.Client{Transport: auth}, nil
+}
+
+// secret returns value, or the content of file if value is empty
+func secret(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// authTransport adds the credentials to every request
+type authTransport struct {
+	next http.RoundTripper
+
+	// header is the value of the Authorization header, if any
+	header string
+
+	username, password string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	switch {
+	case t.header != "":
+		req.Header.Set("Authorization", t.header)
+	case t.username != "":
+		req.SetBasicAuth(t.username, t.password)
+	}
+	return t.next.RoundTrip(req)
+}
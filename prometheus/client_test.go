@@ -0,0 +1,41 @@
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name string
+		cfg  ClientConfig
+		want string
+	}{
+		{"none", ClientConfig{}, ""},
+		{"bearer", ClientConfig{BearerToken: "secret"}, "Bearer secret"},
+		{"basic", ClientConfig{Username: "user", Password: "pass"}, "Basic dXNlcjpwYXNz"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(tc.cfg)
+			if err != nil {
+				t.Fatalf("while creating the client: %v", err)
+			}
+			res, err := client.Get(ts.URL)
+			if err != nil {
+				t.Fatalf("while querying: %v", err)
+			}
+			res.Body.Close()
+
+			if authorization != tc.want {
+				t.Errorf("expected Authorization %q, got %q", tc.want, authorization)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package prometheus
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultQueryTimeout is the query.timeout of Prometheus when it is not set
+const defaultQueryTimeout = 2 * time.Minute
+
+// dropPrefix, prepended to the name of a default flag in the overrides,
+// drops that flag
+const dropPrefix = "no-"
+
+// DefaultFlags are the Prometheus flags suited to serving the TSDB of a past
+// test run. Flags with an empty value are passed without one
+var DefaultFlags = map[string]string{
+	// Keep every block, whatever its age. The flag appeared in Prometheus
+	// 2.7, the oldest default image
+	"storage.tsdb.retention.time": "100y",
+
+	// The TSDB is a throwaway copy, and may sit on a read-only filesystem
+	"storage.tsdb.no-lockfile": "",
+
+	// Range queries over a whole test run touch many samples
+	"query.max-samples":    "200000000",
+	"query.timeout":        "10m",
+	"query.lookback-delta": "15m",
+}
+
+// ManagedFlags are set by the backends, and can not be overridden
+var ManagedFlags = []string{
+	"config.file",
+	"storage.tsdb.path",
+	"web.listen-address",
+}
+
+// QueryTimeout returns the query.timeout the instances run with, once
+// overrides are merged into the default flags
+func QueryTimeout(overrides map[string]string) (time.Duration, error) {
+	value, ok := merge(overrides)["query.timeout"]
+	if !ok || value == "" {
+		return defaultQueryTimeout, nil
+	}
+	return ParseDuration(value)
+}
+
+// Flags merges overrides into the default flags, and returns them as
+// command line arguments sorted by name
+func Flags(overrides map[string]string) []string {
+	merged := merge(overrides)
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, len(names))
+	for _, name := range names {
+		arg := "--" + name
+		if merged[name] != "" {
+			arg += "=" + merged[name]
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// merge returns the default flags with overrides applied. An override named
+// after a default flag with the "no-" prefix, e.g. no-query.timeout, drops
+// it. Other names starting with "no-", like the negations of boolean flags,
+// are passed as they are
+func merge(overrides map[string]string) map[string]string {
+	merged := map[string]string{}
+	for name, value := range DefaultFlags {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		if dropped := strings.TrimPrefix(name, dropPrefix); dropped != name {
+			if _, ok := DefaultFlags[dropped]; ok {
+				delete(merged, dropped)
+				continue
+			}
+		}
+		merged[name] = value
+	}
+	return merged
+}
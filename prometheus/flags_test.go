@@ -0,0 +1,66 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlags(t *testing.T) {
+	have := Flags(map[string]string{
+		"query.timeout":        "30m",
+		"web.enable-lifecycle": "",
+	})
+	want := []string{
+		"--query.lookback-delta=15m",
+		"--query.max-samples=200000000",
+		"--query.timeout=30m",
+		"--storage.tsdb.no-lockfile",
+		"--storage.tsdb.retention.time=100y",
+		"--web.enable-lifecycle",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("expected %v, got %v", want, have)
+	}
+}
+
+func TestFlagsDrop(t *testing.T) {
+	have := Flags(map[string]string{
+		"no-storage.tsdb.retention.time": "",
+		"no-query.lookback-delta":        "",
+		"no-web.enable-lifecycle":        "",
+		"storage.tsdb.retention.size":    "1GB",
+	})
+	want := []string{
+		"--no-web.enable-lifecycle",
+		"--query.max-samples=200000000",
+		"--query.timeout=10m",
+		"--storage.tsdb.no-lockfile",
+		"--storage.tsdb.retention.size=1GB",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("expected %v, got %v", want, have)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	for _, tc := range [...]struct {
+		name      string
+		overrides map[string]string
+		expected  time.Duration
+	}{
+		{"default", nil, 10 * time.Minute},
+		{"override", map[string]string{"query.timeout": "1h"}, time.Hour},
+		{"dropped", map[string]string{"no-query.timeout": ""}, 2 * time.Minute},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			have, err := QueryTimeout(tc.overrides)
+			if err != nil {
+				t.Fatalf("while reading the timeout: %v", err)
+			}
+			if have != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, have)
+			}
+		})
+	}
+}
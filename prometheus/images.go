@@ -0,0 +1,61 @@
+package prometheus
+
+import (
+	"fmt"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/tsdb"
+)
+
+// ImageRule states the TSDB features a Prometheus image can read
+type ImageRule struct {
+	Image string
+
+	// MaxMetaVersion and MaxIndexVersion are the highest block formats
+	// the image reads
+	MaxMetaVersion  int
+	MaxIndexVersion int
+
+	// LegacyWAL and WALCompression are set if the image reads the WAL
+	// written before Prometheus 2.4, and compressed WAL records
+	LegacyWAL      bool
+	WALCompression bool
+}
+
+// DefaultImages is the compatibility table used when the config has none.
+// Older images come first, so that the data of older releases keeps being
+// read by the Prometheus that wrote it
+var DefaultImages = []ImageRule{
+	{
+		Image:           "docker.io/prom/prometheus:v2.7.2",
+		MaxMetaVersion:  1,
+		MaxIndexVersion: 2,
+		LegacyWAL:       true,
+	},
+	{
+		Image:           "docker.io/prom/prometheus:v2.15.2",
+		MaxMetaVersion:  1,
+		MaxIndexVersion: 2,
+		LegacyWAL:       true,
+		WALCompression:  true,
+	},
+}
+
+// reads reports whether the image of the rule can read a TSDB with the
+// given features
+func (r ImageRule) reads(f tsdb.Features) bool {
+	return f.MetaVersion <= r.MaxMetaVersion &&
+		f.IndexVersion <= r.MaxIndexVersion &&
+		(r.LegacyWAL || !f.LegacyWAL) &&
+		(r.WALCompression || !f.WALCompression)
+}
+
+// SelectImage returns the image of the first rule able to read a TSDB with
+// the given features
+func SelectImage(rules []ImageRule, f tsdb.Features) (string, error) {
+	for _, rule := range rules {
+		if rule.reads(f) {
+			return rule.Image, nil
+		}
+	}
+	return "", fmt.Errorf("no image in the compatibility table reads a TSDB with %+v", f)
+}
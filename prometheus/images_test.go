@@ -0,0 +1,33 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/tsdb"
+)
+
+func TestSelectImage(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		features tsdb.Features
+		want     string
+	}{
+		{"old", tsdb.Features{MetaVersion: 1, IndexVersion: 2}, "docker.io/prom/prometheus:v2.7.2"},
+		{"compressed WAL", tsdb.Features{MetaVersion: 1, IndexVersion: 2, WALCompression: true}, "docker.io/prom/prometheus:v2.15.2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			image, err := SelectImage(DefaultImages, tc.features)
+			if err != nil {
+				t.Fatalf("while selecting: %v", err)
+			}
+			if image != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, image)
+			}
+		})
+	}
+
+	_, err := SelectImage(DefaultImages, tsdb.Features{IndexVersion: 3})
+	if err == nil {
+		t.Errorf("expected no image to read index version 3")
+	}
+}
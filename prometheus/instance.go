@@ -2,75 +2,451 @@ package prometheus
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	volumetypes "github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 )
 
+const (
+	// dataMount is where the TSDB is mounted in the container
+	dataMount = "/etc/prometheus/data"
+
+	// nobody is the user Prometheus runs as in the image
+	nobody = 65534
+)
+
+// Docker runs Prometheus in containers through the Docker Engine API. It
+// also drives Podman, whose socket serves a compatible API
+type Docker struct {
+	// Host is the address of the API, e.g. "unix:///run/podman/podman.sock".
+	// When empty, it is read from the DOCKER_HOST environment variable
+	Host string
+
+	// BindOptions are appended to the bind mount of the TSDB, e.g. "Z" to
+	// relabel it for SELinux
+	BindOptions string
+
+	// CopyData copies the TSDB into a volume instead of bind-mounting it,
+	// for daemons that do not share the local filesystem
+	CopyData bool
+
+	// BindAddress is the address of the host of a remote daemon the
+	// Prometheus port is published on. It must be set for remote daemons;
+	// "0.0.0.0" publishes the port on every interface. Local daemons always
+	// publish it on 127.0.0.1
+	BindAddress string
+
+	// pulls serializes the image pulls
+	pulls sync.Mutex
+}
+
+// NewPodman returns a backend talking to the Podman socket. The socket of
+// the user is used when running rootless
+func NewPodman() *Docker {
+	socket := "/run/podman/podman.sock"
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		socket = filepath.Join(dir, "podman", "podman.sock")
+	}
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return &Docker{Host: host, BindOptions: "Z"}
+	}
+	return &Docker{Host: "unix://" + socket, BindOptions: "Z"}
+}
+
+func (d *Docker) client() (*client.Client, error) {
+	if d.Host == "" {
+		return client.NewEnvClient()
+	}
+	return client.NewClient(d.Host, client.DefaultVersion, nil, nil)
+}
+
 // Up stands up a prom container
-func Up(port, dataPath string) (string, error) {
-	cli, err := client.NewEnvClient()
+func (d *Docker) Up(ctx context.Context, spec Spec) (Instance, error) {
+	cli, err := d.client()
 	if err != nil {
-		return "", fmt.Errorf("Unable to create docker client: %v", err)
+		return Instance{}, fmt.Errorf("Unable to create docker client: %v", err)
 	}
 
-	hostBinding := nat.PortBinding{
-		HostIP:   "0.0.0.0",
-		HostPort: port,
+	// The daemon picks the port, on localhost for a local daemon and on
+	// BindAddress for a remote one, which has to be reachable from here.
+	// Picking it here would race with the other instances starting
+	remote := d.remoteHost()
+	hostBinding := nat.PortBinding{HostIP: "127.0.0.1"}
+	if remote != "" {
+		if err := d.checkRemote(remote); err != nil {
+			return Instance{}, err
+		}
+		hostBinding.HostIP = d.BindAddress
+	}
+
+	err = d.pull(ctx, cli, spec.Image)
+	if err != nil {
+		return Instance{}, err
 	}
 
 	containerPort, err := nat.NewPort("tcp", "9090")
 	if err != nil {
-		return "", fmt.Errorf("failed to create port: %v", err)
+		return Instance{}, fmt.Errorf("failed to create port: %v", err)
 	}
 
 	portBinding := nat.PortMap{
 		containerPort: []nat.PortBinding{hostBinding},
 	}
-	volumeBinding := []string{
-		dataPath + ":/etc/prometheus/data",
+	host, err := Hostname()
+	if err != nil {
+		return Instance{}, err
+	}
+	labels := map[string]string{
+		LabelManaged: "true",
+		LabelPID:     strconv.Itoa(os.Getpid()),
+		LabelHost:    host,
+		LabelDataDir: spec.DataDir,
 	}
+
+	instance := Instance{}
+	bind := spec.DataPath + ":" + dataMount
+	if d.CopyData {
+		vol, err := cli.VolumeCreate(ctx, volumetypes.VolumesCreateBody{Labels: labels})
+		if err != nil {
+			return Instance{}, fmt.Errorf("failed to create volume: %v", err)
+		}
+		instance.volume = vol.Name
+		bind = vol.Name + ":" + dataMount
+	} else if d.BindOptions != "" {
+		bind += ":" + d.BindOptions
+	}
+
 	cont, err := cli.ContainerCreate(
-		context.Background(),
+		ctx,
 		&container.Config{
-			Image: "prom/prometheus:v2.6.0",
+			Image: spec.Image,
+			Cmd: append([]string{
+				// An empty config scrapes nothing, not even Prometheus
+				// itself, so that the TSDB only holds the test run
+				"--config.file=/dev/null",
+				"--storage.tsdb.path=" + dataMount,
+			}, spec.Flags...),
+			Labels: labels,
 		},
 		&container.HostConfig{
-			Binds:        volumeBinding,
+			Binds:        []string{bind},
 			PortBindings: portBinding,
 		}, nil, "")
 	if err != nil {
-		return "", fmt.Errorf("failed to create container: %v", err)
+		d.removeVolume(cli, instance.volume)
+		return Instance{}, fmt.Errorf("failed to create container: %v", err)
+	}
+	instance.ID = cont.ID
+
+	if d.CopyData {
+		err = d.copyData(ctx, cli, cont.ID, spec.DataPath)
+		if err != nil {
+			d.remove(cli, instance)
+			return Instance{}, err
+		}
+	}
+
+	err = cli.ContainerStart(ctx, cont.ID, types.ContainerStartOptions{})
+	if err != nil {
+		d.remove(cli, instance)
+		return Instance{}, fmt.Errorf("failed to start container: %v", err)
 	}
 
-	err = cli.ContainerStart(context.Background(), cont.ID, types.ContainerStartOptions{})
+	port, err := publishedPort(ctx, cli, cont.ID, containerPort)
 	if err != nil {
-		return "", fmt.Errorf("failed to start container: %v", err)
+		d.remove(cli, instance)
+		return Instance{}, err
+	}
+	addr := "127.0.0.1"
+	if remote != "" {
+		addr = remote
+		if ip := net.ParseIP(d.BindAddress); ip == nil || !ip.IsUnspecified() {
+			addr = d.BindAddress
+		}
+	}
+	instance.URL = "http://" + net.JoinHostPort(addr, port)
+
+	log.Printf("Container %s is started on %s\n", cont.ID, instance.URL)
+	return instance, nil
+}
+
+// remoteHost returns the host of the daemon if it is reached over TCP, and
+// an empty string if it runs locally
+func (d *Docker) remoteHost() string {
+	host := d.Host
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
 	}
 
-	log.Printf("Container %s is started\n", cont.ID)
-	return cont.ID, nil
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme != "tcp" {
+		return ""
+	}
+	switch u.Hostname() {
+	case "", "localhost", "127.0.0.1", "::1":
+		return ""
+	}
+	return u.Hostname()
+}
+
+// checkRemote fails if the instances can not run on the remote daemon as
+// configured. A bind mount would mount a path of the remote host, where
+// Prometheus would serve an empty TSDB, and the API is not published on
+// every interface of the remote host by default
+func (d *Docker) checkRemote(remote string) error {
+	if !d.CopyData {
+		return fmt.Errorf("the daemon at %s is remote and can not bind-mount the local TSDB: set dataMode to copy", remote)
+	}
+	if d.BindAddress == "" {
+		return fmt.Errorf("the daemon at %s is remote: set the address of its host the Prometheus API is published on with --bind-address, or 0.0.0.0 for every interface", remote)
+	}
+	return nil
 }
 
-// Down takes down a running prom container
-func Down(id string) error {
-	cli, err := client.NewEnvClient()
+// publishedPort returns the host port the daemon bound to port of the
+// container
+func publishedPort(ctx context.Context, cli *client.Client, id string, port nat.Port) (string, error) {
+	cont, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %v", id, err)
+	}
+	if cont.NetworkSettings != nil {
+		for _, binding := range cont.NetworkSettings.Ports[port] {
+			if binding.HostPort != "" {
+				return binding.HostPort, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("container %s has no published port", id)
+}
+
+// copyData streams the TSDB at dataPath into the volume of the container,
+// owned by the user Prometheus runs as in the image
+func (d *Docker) copyData(ctx context.Context, cli *client.Client, id, dataPath string) error {
+	archive := tarDir(dataPath, path.Base(dataMount), nobody, nobody)
+	defer archive.Close()
+
+	log.Printf("Copying %s into container %s", dataPath, id)
+	err := cli.CopyToContainer(ctx, id, path.Dir(dataMount), archive, types.CopyToContainerOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to copy the TSDB into container %s: %v", id, err)
+	}
+	return nil
+}
+
+// pull pulls image unless it is present, and logs the progress of every layer
+func (d *Docker) pull(ctx context.Context, cli *client.Client, image string) error {
+	d.pulls.Lock()
+	defer d.pulls.Unlock()
+
+	_, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrImageNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %v", image, err)
+	}
+
+	log.Printf("Pulling image %s", image)
+	progress, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %v", image, err)
+	}
+	defer progress.Close()
+
+	// Only log when the status of a layer changes, the download
+	// progress itself is too verbose
+	statuses := map[string]string{}
+	decoder := json.NewDecoder(progress)
+	for {
+		var msg struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to pull image %s: %v", image, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", image, msg.Error)
+		}
+		if statuses[msg.ID] != msg.Status {
+			statuses[msg.ID] = msg.Status
+			log.Printf("%s: %s %s", image, msg.ID, msg.Status)
+		}
+	}
+
+	log.Printf("Pulled image %s", image)
+	return nil
+}
+
+// Logs returns the output of the container
+func (d *Docker) Logs(instance Instance) ([]byte, error) {
+	cli, err := d.client()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create docker client: %v", err)
+	}
+
+	logs, err := cli.ContainerLogs(context.Background(), instance.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of container %s: %v", instance.ID, err)
+	}
+	defer logs.Close()
+
+	return demux(logs)
+}
+
+// Exited inspects the container of instance, and returns its exit code once
+// it stopped
+func (d *Docker) Exited(ctx context.Context, instance Instance) error {
+	cli, err := d.client()
+	if err != nil {
+		return nil
+	}
+
+	cont, err := cli.ContainerInspect(ctx, instance.ID)
+	if client.IsErrContainerNotFound(err) {
+		return fmt.Errorf("container %s is gone", instance.ID)
+	}
+	if err != nil || cont.State == nil || cont.State.Running {
+		return nil
+	}
+	switch {
+	case cont.State.OOMKilled:
+		return fmt.Errorf("container %s was killed for lack of memory", instance.ID)
+	case cont.State.Error != "":
+		return fmt.Errorf("container %s failed: %s", instance.ID, cont.State.Error)
+	}
+	return fmt.Errorf("container %s is %s, with exit code %d", instance.ID, cont.State.Status, cont.State.ExitCode)
+}
+
+// Down takes down a running prom container and removes it
+func (d *Docker) Down(instance Instance) error {
+	id := instance.ID
+	cli, err := d.client()
 	if err != nil {
 		return fmt.Errorf("Unable to create docker client: %v", err)
 	}
 
-	cli.ContainerStop(context.Background(), id, nil)
+	err = cli.ContainerStop(context.Background(), id, nil)
 	if err != nil {
-		return fmt.Errorf("unable to delete container %s: %v", id, err)
+		d.remove(cli, instance)
+		return fmt.Errorf("unable to stop container %s: %v", id, err)
 	}
 
 	_, err = cli.ContainerWait(context.Background(), id)
 	if err != nil {
+		d.remove(cli, instance)
 		return fmt.Errorf("failed to wait for container %s to stop", id)
 	}
+
+	return d.remove(cli, instance)
+}
+
+// remove force-removes the container of instance, and its volume
+func (d *Docker) remove(cli *client.Client, instance Instance) error {
+	err := cli.ContainerRemove(context.Background(), instance.ID, types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to remove container %s: %v", instance.ID, err)
+	}
+	return d.removeVolume(cli, instance.volume)
+}
+
+// removeVolume removes the volume name, if any
+func (d *Docker) removeVolume(cli *client.Client, name string) error {
+	if name == "" {
+		return nil
+	}
+	err := cli.VolumeRemove(context.Background(), name, true)
+	if err != nil {
+		return fmt.Errorf("unable to remove volume %s: %v", name, err)
+	}
 	return nil
 }
+
+// RemoveOrphans removes the labelled containers whose run is no longer alive.
+// Only the containers created from this host are considered: the daemon may
+// be shared with the runs of other hosts, whose PIDs mean nothing here
+func (d *Docker) RemoveOrphans(ctx context.Context) ([]string, error) {
+	cli, err := d.client()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create docker client: %v", err)
+	}
+	host, err := Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	labelled := filters.NewArgs()
+	labelled.Add("label", LabelManaged+"=true")
+	labelled.Add("label", LabelHost+"="+host)
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: labelled,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	dataDirs := []string{}
+	for _, cont := range containers {
+		pid, err := strconv.Atoi(cont.Labels[LabelPID])
+		if err == nil && Alive(pid) {
+			continue
+		}
+
+		log.Printf("Removing container %s left by process %s", cont.ID, cont.Labels[LabelPID])
+		err = d.remove(cli, Instance{ID: cont.ID})
+		if err != nil {
+			return dataDirs, err
+		}
+		if dir := cont.Labels[LabelDataDir]; dir != "" {
+			dataDirs = append(dataDirs, dir)
+		}
+	}
+
+	// The volumes of the copy mode outlive their container if the run
+	// died between the two
+	volumes, err := cli.VolumeList(ctx, labelled)
+	if err != nil {
+		return dataDirs, fmt.Errorf("failed to list volumes: %v", err)
+	}
+	for _, vol := range volumes.Volumes {
+		pid, err := strconv.Atoi(vol.Labels[LabelPID])
+		if err == nil && Alive(pid) {
+			continue
+		}
+
+		log.Printf("Removing volume %s left by process %s", vol.Name, vol.Labels[LabelPID])
+		err = d.removeVolume(cli, vol.Name)
+		if err != nil {
+			return dataDirs, err
+		}
+	}
+	return dataDirs, nil
+}
@@ -0,0 +1,28 @@
+package prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDockerRemote(t *testing.T) {
+	// The daemon is never reached: the configuration is checked first
+	const host = "tcp://192.0.2.1:2375"
+
+	for _, tc := range [...]struct {
+		name     string
+		docker   *Docker
+		expected string
+	}{
+		{"bind mode", &Docker{Host: host, BindAddress: "192.0.2.1"}, "set dataMode to copy"},
+		{"no bind address", &Docker{Host: host, CopyData: true}, "--bind-address"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.docker.Up(context.Background(), Spec{DataPath: "/nonexistent", Image: "prom/prometheus"})
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected an error mentioning %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
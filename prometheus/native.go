@@ -0,0 +1,173 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// defaultGracePeriod is how long Down waits for a process to exit on SIGINT,
+// as long as the daemon waits for a container to stop
+const defaultGracePeriod = 10 * time.Second
+
+// Native runs a local prometheus binary against the TSDB directory, for
+// hosts that can not run containers
+type Native struct {
+	// Binary is the path of the prometheus binary, or its name in PATH
+	Binary string
+
+	// GracePeriod is how long Down waits for a process to exit after
+	// SIGINT, before killing it
+	GracePeriod time.Duration
+
+	sync.Mutex
+	procs map[string]*nativeProc
+}
+
+type nativeProc struct {
+	cmd  *exec.Cmd
+	logs *logBuffer
+
+	// done is closed once the process exited, with the error of its Wait
+	// in err
+	done chan struct{}
+	err  error
+}
+
+// NewNative returns a backend running binary. It defaults to the
+// prometheus found in PATH
+func NewNative(binary string) *Native {
+	if binary == "" {
+		binary = "prometheus"
+	}
+	return &Native{
+		Binary:      binary,
+		GracePeriod: defaultGracePeriod,
+		procs:       map[string]*nativeProc{},
+	}
+}
+
+// Up starts a prometheus process listening on a free port. The image of the
+// spec is ignored, the version of the binary is the one run
+func (n *Native) Up(ctx context.Context, spec Spec) (Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return Instance{}, err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return Instance{}, err
+	}
+
+	args := append([]string{
+		// Prometheus refuses to start without a config file; an empty one
+		// scrapes nothing, as in the containers
+		"--config.file=" + os.DevNull,
+		"--storage.tsdb.path=" + spec.DataPath,
+		"--web.listen-address=127.0.0.1:" + port,
+	}, spec.Flags...)
+	cmd := exec.Command(n.Binary, args...)
+	cmd.SysProcAttr = procAttr()
+	logs := &logBuffer{}
+	cmd.Stdout, cmd.Stderr = logs, logs
+	err = cmd.Start()
+	if err != nil {
+		return Instance{}, fmt.Errorf("failed to start %s: %v", n.Binary, err)
+	}
+
+	proc := &nativeProc{cmd: cmd, logs: logs, done: make(chan struct{})}
+	go func() {
+		proc.err = cmd.Wait()
+		close(proc.done)
+	}()
+
+	id := fmt.Sprint(cmd.Process.Pid)
+	n.Lock()
+	n.procs[id] = proc
+	n.Unlock()
+
+	log.Printf("Prometheus process %s is started on port %s\n", id, port)
+	return Instance{ID: id, URL: "http://127.0.0.1:" + port}, nil
+}
+
+// Logs returns the output of the prometheus process
+func (n *Native) Logs(instance Instance) ([]byte, error) {
+	n.Lock()
+	proc, ok := n.procs[instance.ID]
+	n.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown prometheus process %s", instance.ID)
+	}
+	return proc.logs.Bytes(), nil
+}
+
+// Exited returns how the prometheus process exited, if it did
+func (n *Native) Exited(ctx context.Context, instance Instance) error {
+	n.Lock()
+	proc, ok := n.procs[instance.ID]
+	n.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown prometheus process %s", instance.ID)
+	}
+
+	select {
+	case <-proc.done:
+		if proc.err != nil {
+			return fmt.Errorf("prometheus process %s exited: %v", instance.ID, proc.err)
+		}
+		return fmt.Errorf("prometheus process %s exited", instance.ID)
+	default:
+		return nil
+	}
+}
+
+// Down stops the prometheus process and waits for it to exit, killing it
+// after the grace period
+func (n *Native) Down(instance Instance) error {
+	id := instance.ID
+	n.Lock()
+	proc, ok := n.procs[id]
+	delete(n.procs, id)
+	n.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown prometheus process %s", id)
+	}
+
+	select {
+	case <-proc.done:
+		// It already exited, e.g. on a startup failure
+	default:
+		err := proc.cmd.Process.Signal(os.Interrupt)
+		if err != nil {
+			return fmt.Errorf("unable to stop prometheus process %s: %v", id, err)
+		}
+
+		timer := time.NewTimer(n.GracePeriod)
+		defer timer.Stop()
+		select {
+		case <-proc.done:
+		case <-timer.C:
+			log.Printf("Prometheus process %s did not exit within %v, killing it", id, n.GracePeriod)
+			err := proc.cmd.Process.Kill()
+			if err != nil {
+				return fmt.Errorf("unable to kill prometheus process %s: %v", id, err)
+			}
+			<-proc.done
+		}
+	}
+
+	if proc.err != nil {
+		return fmt.Errorf("prometheus process %s did not exit cleanly: %v", id, proc.err)
+	}
+	return nil
+}
+
+// RemoveOrphans does nothing: the prometheus processes are stopped by the run
+// when it exits, and killed by the kernel when it dies, on Linux
+func (n *Native) RemoveOrphans(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,13 @@
+package prometheus
+
+import "syscall"
+
+// procAttr puts the prometheus processes in their own process group, so that
+// the signals of the terminal only reach the run, which stops them itself.
+// They are killed if the run dies without stopping them
+func procAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
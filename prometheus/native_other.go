@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package prometheus
+
+import "syscall"
+
+// procAttr puts the prometheus processes in their own process group, so that
+// the signals of the terminal only reach the run, which stops them itself.
+// Only Linux kills them if the run dies without stopping them
+func procAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
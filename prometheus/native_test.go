@@ -0,0 +1,74 @@
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNativeExited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := NewNative("false")
+	instance, err := n.Up(context.Background(), Spec{DataPath: dir})
+	if err != nil {
+		t.Fatalf("while starting: %v", err)
+	}
+
+	err = WaitReady(context.Background(), n, instance, time.Minute)
+	if err == nil {
+		t.Errorf("expected an error, the process exited")
+	}
+	if n.Exited(context.Background(), instance) == nil {
+		t.Errorf("expected the process to be reported as exited")
+	}
+	if err := n.Down(instance); err == nil {
+		t.Errorf("expected Down to report the exit status")
+	}
+}
+
+func TestNativeKilled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A process ignoring SIGINT, which creates ready once it does
+	binary, ready := filepath.Join(dir, "prometheus"), filepath.Join(dir, "ready")
+	err = ioutil.WriteFile(binary, []byte("#!/bin/sh\ntrap '' INT\ntouch "+ready+"\nexec sleep 60\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := NewNative(binary)
+	n.GracePeriod = 100 * time.Millisecond
+	instance, err := n.Up(context.Background(), Spec{DataPath: dir})
+	if err != nil {
+		t.Fatalf("while starting: %v", err)
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the process did not start")
+		}
+	}
+
+	start := time.Now()
+	if err := n.Down(instance); err == nil {
+		t.Errorf("expected Down to report that the process was killed")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the process to be killed after the grace period, Down took %v", elapsed)
+	}
+}
@@ -0,0 +1,107 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readyInterval is how often the readiness of an instance is polled
+const readyInterval = time.Second
+
+// WaitReady polls the /-/ready endpoint of instance until it answers, which
+// only happens once Prometheus has loaded the TSDB and replayed its WAL. It
+// gives up after timeout, as soon as the instance exits, or as soon as ctx is
+// cancelled
+func WaitReady(ctx context.Context, backend Backend, instance Instance, timeout time.Duration) error {
+	client := http.Client{Timeout: readyInterval}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		req, err := http.NewRequest("GET", instance.URL+"/-/ready", nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req.WithContext(ctx))
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("bad status: %s", res.Status)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if exitErr := backend.Exited(ctx, instance); exitErr != nil {
+			return fmt.Errorf("Prometheus stopped before being ready: %v", exitErr)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Prometheus was not ready after %v: %v", timeout, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// Tail returns the last n lines of logs
+func Tail(logs []byte, n int) string {
+	lines := strings.Split(strings.TrimRight(string(logs), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// demux reads the multiplexed stream returned by the logs of a container
+// without TTY. Every frame has an 8 bytes header: the stream, 3 unused bytes
+// and the big endian size of the payload. stdout and stderr are merged
+func demux(r io.Reader) ([]byte, error) {
+	var out bytes.Buffer
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return out.Bytes(), err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		_, err = io.CopyN(&out, r, size)
+		if err != nil {
+			return out.Bytes(), err
+		}
+	}
+}
+
+// logBuffer collects the output of a process. It is safe to read while the
+// process writes to it
+type logBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) Bytes() []byte {
+	b.Lock()
+	defer b.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
+}
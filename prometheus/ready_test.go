@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func frame(stream byte, payload string) []byte {
+	header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemux(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "level=info msg=\"Starting Prometheus\"\n"))
+	stream.Write(frame(2, "level=error msg=\"Opening storage failed\"\n"))
+
+	logs, err := demux(&stream)
+	if err != nil {
+		t.Fatalf("while demultiplexing: %v", err)
+	}
+	want := "level=info msg=\"Starting Prometheus\"\nlevel=error msg=\"Opening storage failed\"\n"
+	if string(logs) != want {
+		t.Errorf("expected %q, got %q", want, logs)
+	}
+}
+
+func TestTail(t *testing.T) {
+	if have := Tail([]byte("a\nb\nc\n"), 2); have != "b\nc" {
+		t.Errorf("expected the last 2 lines, got %q", have)
+	}
+	if have := Tail([]byte("a\n"), 2); have != "a" {
+		t.Errorf("expected the only line, got %q", have)
+	}
+}
+
+// exitedBackend is a backend whose instances exit right after starting
+type exitedBackend struct {
+	Native
+}
+
+func (b *exitedBackend) Exited(ctx context.Context, instance Instance) error {
+	return fmt.Errorf("exit status 1")
+}
+
+func TestWaitReadyExited(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	err := WaitReady(context.Background(), &exitedBackend{}, Instance{URL: ts.URL}, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("expected the exit status, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("waited %v for an instance that exited", time.Since(start))
+	}
+}
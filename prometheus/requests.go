@@ -1,7 +1,7 @@
 package prometheus
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,79 +9,83 @@ import (
 )
 
 const (
-	httpRequestTimeout = 10 * time.Second
-
 	//QueryTypeRange is a constant string used to identify ranged queries
 	QueryTypeRange = "range"
 )
 
 // Query is a generic way to build a prometheus query
 type Query struct {
-	MetricName string            // Name of the prometheus metric you are querying for
-	BaseURL    string            // URL of the prometheus server you are querying
-	QueryType  string            // Type of prometheus query: instant, range
-	Params     map[string]string // Prometheus Query Parameters
+	MetricName string       // Name of the prometheus metric you are querying for
+	BaseURL    string       // URL of the prometheus server you are querying
+	QueryType  string       // Type of prometheus query: only range is supported
+	Expr       string       // PromQL expression to evaluate
+	Range      Range        // Time span and step of range queries
+	Client     *http.Client // Client making the requests, with no credentials if nil
+
+	// Timeout bounds every attempt, and is passed on to Prometheus. Zero
+	// leaves the attempts bounded by ctx only
+	Timeout time.Duration
 }
 
-// GetData makes a GET query against prometheus and returns data
-func (query *Query) GetData() (*RangeResult, error) {
+// GetData runs the query against prometheus and returns data. Failures that
+// may be transient are retried
+func (query *Query) GetData(ctx context.Context) (*RangeResult, error) {
 	if query == nil {
 		log.Fatal("query parameter can not be nil")
 	}
-	// Execute Range Query
+	if query.QueryType != QueryTypeRange {
+		return nil, fmt.Errorf("unsupported query type %q", query.QueryType)
+	}
+
+	api := NewAPI(query.BaseURL, query.Client)
 	retries := 5
-	var err error
-	var result *RangeResult
+	for {
+		result, warnings, err := query.attempt(ctx, api)
+		for _, warning := range warnings {
+			log.Printf("Prometheus warning for %s: %s", query.MetricName, warning)
+		}
+		if err == nil {
+			return result, nil
+		}
 
-	// TODO(egarcia): implement proper http error handling
-	for retries > 0 {
-		if query.QueryType == QueryTypeRange {
-			result, err = rangeQuery(query.BaseURL, &query.Params)
-			if err != nil {
-				time.Sleep(5 * time.Second)
-				retries--
-			} else {
-				return result, nil
-			}
+		// A query that used up its timeout would only time out again
+		if _, ok := err.(*TimeoutError); ok {
+			return nil, err
 		}
-	}
 
-	return nil, err
+		retries--
+		if apiErr, ok := err.(*APIError); (ok && !apiErr.Temporary()) || retries == 0 {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
 
+// TimeoutError is returned when a query did not complete within its timeout
+type TimeoutError struct {
+	Timeout time.Duration
+	Err     error
 }
 
-func rangeQuery(baseURL string, params *map[string]string) (*RangeResult, error) {
-	if params == nil || len(*params) <= 0 {
-		return nil, fmt.Errorf("nil or empty rangeQuery params")
-	}
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("the query timed out after %v: %v", e.Timeout, e.Err)
+}
 
-	// Build Query
-	query := baseURL + "/api/v1/query_range"
-	count := 0
-	for key, value := range *params {
-		if count == 0 {
-			query = query + "?" + key + "=" + value
-		} else {
-			query = query + "&" + key + "=" + value
-		}
-		count++
+// attempt runs the query once, within its timeout
+func (query *Query) attempt(ctx context.Context, api *API) (*RangeResult, Warnings, error) {
+	if query.Timeout <= 0 {
+		return api.QueryRange(ctx, query.Expr, query.Range)
 	}
 
-	// Fetch time series Prometheus data
-	client := http.Client{Timeout: httpRequestTimeout}
-	res, err := client.Get(query)
-	if err != nil {
-		return nil, fmt.Errorf("http GET error: %v", err)
-	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error %d: %s", res.StatusCode, res.Status)
-	}
-	decoder := json.NewDecoder(res.Body)
-	var result RangeResult
-	err = decoder.Decode(&result)
-	if err != nil {
-		return nil, err
+	attemptCtx, cancel := context.WithTimeout(ctx, query.Timeout)
+	defer cancel()
+	result, warnings, err := api.QueryRange(attemptCtx, query.Expr, query.Range)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return nil, warnings, &TimeoutError{Timeout: query.Timeout, Err: err}
 	}
-	return &result, nil
+	return result, warnings, err
 }
@@ -0,0 +1,42 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetDataTimeout(t *testing.T) {
+	var requests int
+	var timeout string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		timeout = req.FormValue("timeout")
+		select {
+		case <-req.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	query := Query{
+		BaseURL:   ts.URL,
+		QueryType: QueryTypeRange,
+		Expr:      "up",
+		Range:     Range{Start: time.Unix(1569931200, 0), End: time.Unix(1569931260, 0), Step: "30s"},
+		Timeout:   100 * time.Millisecond,
+	}
+	_, err := query.GetData(context.Background())
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("expected the query to time out, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected a query that timed out not to be retried, found %d requests", requests)
+	}
+	if seconds, err := strconv.ParseFloat(timeout, 64); err != nil || seconds <= 0 || seconds > 0.1 {
+		t.Errorf("expected the timeout to be passed on, got %q", timeout)
+	}
+}
@@ -2,6 +2,9 @@ package prometheus
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -17,19 +20,11 @@ type resultList struct {
 }
 
 // result represents the result of the query for each pod
-// it was measuring
+// it was measuring. Range queries fill Values, instant ones Value
 type result struct {
-	Metric metric `json:"metric"`
+	Metric map[string]string `json:"metric"`
 	Values [][]interface{}
-}
-
-type metric struct {
-	Endpoint  string `json:"endpoint"`
-	Instance  string `json:"instance"`
-	Job       string `json:"job"`
-	Namespace string `json:"namespace"`
-	Pod       string `json:"pod"`
-	Service   string `json:"service"`
+	Value  []interface{} `json:"value"`
 }
 
 // Flatten creates a csv like slice of slices to hold the essential
@@ -43,11 +38,7 @@ func (rr *RangeResult) Flatten() ([][]string, error) {
 
 	for _, pod := range rr.Data.Result {
 		podData := []string{}
-		node, err := getNode(pod.Metric.Pod)
-		if err != nil {
-			return nil, err
-		}
-		podData = append(podData, node)
+		podData = append(podData, seriesName(pod.Metric))
 		for _, value := range pod.Values {
 			data := fmt.Sprintf("%v", []interface{}(value)[1])
 			podData = append(podData, data)
@@ -57,6 +48,59 @@ func (rr *RangeResult) Flatten() ([][]string, error) {
 	return result, nil
 }
 
+// Max returns the highest value of all the series of a RangeResult. ok is
+// false if the result holds no value
+func (rr *RangeResult) Max() (max float64, ok bool) {
+	if rr == nil {
+		return 0, false
+	}
+
+	max = math.Inf(-1)
+	for _, pod := range rr.Data.Result {
+		for _, value := range pod.Values {
+			v, err := strconv.ParseFloat(fmt.Sprintf("%v", value[1]), 64)
+			if err != nil || math.IsNaN(v) {
+				continue
+			}
+			if v > max {
+				max, ok = v, true
+			}
+		}
+	}
+	return max, ok
+}
+
+// seriesName names a series after the node its pod ran on. Series with no
+// pod, like the ones of aggregations, are named after their instance or node
+// label, and else after all their labels
+func seriesName(labels map[string]string) string {
+	if pod, ok := labels["pod"]; ok {
+		if node, err := getNode(pod); err == nil {
+			return node
+		}
+		return pod
+	}
+	for _, label := range []string{"instance", "node"} {
+		if value, ok := labels[label]; ok {
+			return value
+		}
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
 // Helper function to clean up main body
 // Gets node name "master-#" "worker-#"
 func getNode(pod string) (string, error) {
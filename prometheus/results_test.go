@@ -0,0 +1,20 @@
+package prometheus
+
+import "testing"
+
+func TestSeriesName(t *testing.T) {
+	for _, tc := range []struct {
+		labels map[string]string
+		want   string
+	}{
+		{map[string]string{"pod": "etcd-member-master-0", "instance": "10.0.0.5:2379"}, "master-0"},
+		{map[string]string{"pod": "etcd-quorum-guard"}, "etcd-quorum-guard"},
+		{map[string]string{"instance": "10.0.0.5:2379"}, "10.0.0.5:2379"},
+		{map[string]string{"job": "etcd", "code": "500"}, `{code="500",job="etcd"}`},
+		{map[string]string{}, ""},
+	} {
+		if got := seriesName(tc.labels); got != tc.want {
+			t.Errorf("%v: expected %q, got %q", tc.labels, tc.want, got)
+		}
+	}
+}
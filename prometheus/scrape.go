@@ -0,0 +1,50 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scrapeWindow is the range the samples are counted over to estimate the
+// scrape interval
+const scrapeWindow = 10 * time.Minute
+
+// ScrapeInterval estimates how often series was scraped, from the number of
+// samples of its densest series in the ten minutes before at. It returns 0
+// if series has too few samples to tell
+func ScrapeInterval(ctx context.Context, api *API, series string, at time.Time) (time.Duration, error) {
+	query := fmt.Sprintf("max(count_over_time(%s[%ds]))", series, int64(scrapeWindow/time.Second))
+	result, _, err := api.QueryRange(ctx, query, Range{Start: at, End: at, Step: "60"})
+	if err != nil {
+		return 0, err
+	}
+
+	count, ok := result.Max()
+	if !ok || count < 2 {
+		return 0, nil
+	}
+	return scrapeWindow / time.Duration(count), nil
+}
+
+// ParseDuration parses a PromQL duration, like 30s, 5m or 1d
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(s)
+}
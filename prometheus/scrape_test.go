@@ -0,0 +1,47 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScrapeInterval(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query = req.FormValue("query")
+		fmt.Fprint(rw, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1569931200,"20"]]}]}}`)
+	}))
+	defer ts.Close()
+
+	interval, err := ScrapeInterval(context.Background(), NewAPI(ts.URL, nil), "up", time.Unix(1569931200, 0))
+	if err != nil {
+		t.Fatalf("while querying: %v", err)
+	}
+	if query != "max(count_over_time(up[600s]))" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if interval != 30*time.Second {
+		t.Errorf("expected 30s, got %v", interval)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"30s": 30 * time.Second,
+		"5m":  5 * time.Minute,
+		"1d":  24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	} {
+		got, err := ParseDuration(s)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v (%v)", s, want, got, err)
+		}
+	}
+	if _, err := ParseDuration("xd"); err == nil {
+		t.Errorf("expected an error for xd")
+	}
+}
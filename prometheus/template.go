@@ -0,0 +1,61 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// HistogramQuery is the template of the metrics configured by name only:
+// a quantile of a histogram
+const HistogramQuery = "histogram_quantile({{.Quantile}},rate({{.Metric}}[{{.RateWindow}}]))"
+
+// QueryVars are the variables the query templates can reference
+type QueryVars struct {
+	// Metric is the metric the query is about
+	Metric string
+
+	// Step is the step of the range query, and RateWindow the range of the
+	// rates
+	Step       string
+	RateWindow string
+
+	Quantile float64
+
+	// Start and End are the time span queried, in Unix seconds, e.g. for
+	// the @ modifier
+	Start, End int64
+
+	// Duration is the time span queried, as a PromQL duration, e.g. for
+	// increase over the whole span
+	Duration string
+}
+
+// NewQueryVars returns the variables of a query of metric between start
+// and end
+func NewQueryVars(metric, step, rateWindow string, quantile float64, start, end time.Time) QueryVars {
+	return QueryVars{
+		Metric:     metric,
+		Step:       step,
+		RateWindow: rateWindow,
+		Quantile:   quantile,
+		Start:      start.Unix(),
+		End:        end.Unix(),
+		Duration:   fmt.Sprintf("%ds", int64(end.Sub(start)/time.Second)),
+	}
+}
+
+// ParseQuery parses a PromQL template
+func ParseQuery(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// RenderQuery expands tmpl with vars
+func RenderQuery(tmpl *template.Template, vars QueryVars) (string, error) {
+	var query bytes.Buffer
+	if err := tmpl.Execute(&query, vars); err != nil {
+		return "", fmt.Errorf("could not render query %s: %v", tmpl.Name(), err)
+	}
+	return query.String(), nil
+}
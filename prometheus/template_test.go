@@ -0,0 +1,40 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderQuery(t *testing.T) {
+	start := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	vars := NewQueryVars("etcd_disk_wal_fsync_duration_seconds_bucket", "1m", "2m", 0.99, start, start.Add(90*time.Minute))
+
+	for _, tc := range []struct {
+		name, text, want string
+	}{
+		{"histogram", HistogramQuery, "histogram_quantile(0.99,rate(etcd_disk_wal_fsync_duration_seconds_bucket[2m]))"},
+		{"span", "increase({{.Metric}}[{{.Duration}}] @ {{.End}})", "increase(etcd_disk_wal_fsync_duration_seconds_bucket[5400s] @ 1569936600)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseQuery(tc.name, tc.text)
+			if err != nil {
+				t.Fatalf("while parsing: %v", err)
+			}
+			got, err := RenderQuery(tmpl, vars)
+			if err != nil {
+				t.Fatalf("while rendering: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	tmpl, err := ParseQuery("unknown", "rate({{.Unknown}}[5m])")
+	if err != nil {
+		t.Fatalf("while parsing: %v", err)
+	}
+	if _, err := RenderQuery(tmpl, vars); err == nil {
+		t.Errorf("expected an error for an unknown variable")
+	}
+}
@@ -0,0 +1,76 @@
+package prometheus
+
+import "strings"
+
+// The metric types the default queries are chosen by
+const (
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+)
+
+// DefaultQueries are the query templates of the metrics of every type
+var DefaultQueries = map[string]string{
+	TypeHistogram: HistogramQuery,
+	TypeSummary:   `{{.Metric}}{quantile="{{.Quantile}}"}`,
+	TypeCounter:   "rate({{.Metric}}[{{.RateWindow}}])",
+	TypeGauge:     "{{.Metric}}",
+}
+
+// HasQuantiles tells whether the queries of the metrics of type typ are
+// gathered per quantile
+func HasQuantiles(typ string) bool {
+	return typ == TypeHistogram || typ == TypeSummary
+}
+
+// Classify returns the type of metric, from the metadata of the targets if
+// they describe it, else from the suffix of its name. It also returns the
+// series the queries select: the buckets of a histogram
+func Classify(metric string, metadata map[string][]Metadata) (typ, series string) {
+	if typ := metadataType(metadata[metric]); typ != "" {
+		if typ == TypeHistogram {
+			return typ, metric + "_bucket"
+		}
+		return typ, metric
+	}
+
+	// Histograms and summaries are described by the name of their family,
+	// which their series extend
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total"} {
+		if !strings.HasSuffix(metric, suffix) {
+			continue
+		}
+		switch typ := metadataType(metadata[strings.TrimSuffix(metric, suffix)]); {
+		case typ == TypeHistogram && suffix == "_bucket":
+			return TypeHistogram, metric
+		case HasQuantiles(typ) && suffix != "_bucket", typ == TypeCounter:
+			return TypeCounter, metric
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(metric, "_bucket"):
+		return TypeHistogram, metric
+	case strings.HasSuffix(metric, "_total"):
+		return TypeCounter, metric
+	}
+	return TypeGauge, metric
+}
+
+// metadataType returns the type the metadata of a metric agree on, if any
+func metadataType(metadata []Metadata) string {
+	typ := ""
+	for _, m := range metadata {
+		switch m.Type {
+		case TypeHistogram, TypeSummary, TypeCounter, TypeGauge:
+		default:
+			continue
+		}
+		if typ != "" && typ != m.Type {
+			return ""
+		}
+		typ = m.Type
+	}
+	return typ
+}
@@ -0,0 +1,34 @@
+package prometheus
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	metadata := map[string][]Metadata{
+		"etcd_disk_wal_fsync_duration_seconds":  {{Type: TypeHistogram}},
+		"etcd_server_leader_changes_seen_total": {{Type: TypeCounter}},
+		"etcd_mvcc_db_total_size_in_bytes":      {{Type: TypeGauge}},
+		"go_gc_duration_seconds":                {{Type: TypeSummary}},
+		"conflicting":                           {{Type: TypeCounter}, {Type: TypeGauge}},
+	}
+
+	for _, tc := range []struct {
+		metric, typ, series string
+	}{
+		{"etcd_disk_wal_fsync_duration_seconds", TypeHistogram, "etcd_disk_wal_fsync_duration_seconds_bucket"},
+		{"etcd_disk_wal_fsync_duration_seconds_bucket", TypeHistogram, "etcd_disk_wal_fsync_duration_seconds_bucket"},
+		{"etcd_disk_wal_fsync_duration_seconds_count", TypeCounter, "etcd_disk_wal_fsync_duration_seconds_count"},
+		{"etcd_server_leader_changes_seen_total", TypeCounter, "etcd_server_leader_changes_seen_total"},
+		{"etcd_mvcc_db_total_size_in_bytes", TypeGauge, "etcd_mvcc_db_total_size_in_bytes"},
+		{"go_gc_duration_seconds", TypeSummary, "go_gc_duration_seconds"},
+		{"go_gc_duration_seconds_sum", TypeCounter, "go_gc_duration_seconds_sum"},
+		{"conflicting", TypeGauge, "conflicting"},
+		{"apiserver_request_duration_seconds_bucket", TypeHistogram, "apiserver_request_duration_seconds_bucket"},
+		{"apiserver_request_total", TypeCounter, "apiserver_request_total"},
+		{"process_resident_memory_bytes", TypeGauge, "process_resident_memory_bytes"},
+	} {
+		typ, series := Classify(tc.metric, metadata)
+		if typ != tc.typ || series != tc.series {
+			t.Errorf("%s: expected %s %s, got %s %s", tc.metric, tc.typ, tc.series, typ, series)
+		}
+	}
+}
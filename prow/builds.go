@@ -0,0 +1,217 @@
+package prow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
+)
+
+const (
+	httpRequestTimeout = 30 * time.Second
+
+	// ListingGCSWeb enumerates builds by scraping the gcsweb directory listing
+	ListingGCSWeb = "gcsweb"
+
+	// ListingGCS enumerates builds through the GCS JSON API
+	ListingGCS = "gcs"
+)
+
+// gcsAPIURL is the endpoint of the GCS JSON API. It is a variable so that
+// tests can point it to a stand-in server.
+var gcsAPIURL = "https://storage.googleapis.com/storage/v1"
+
+// buildLink matches the links to build directories in a gcsweb listing.
+var buildLink = regexp.MustCompile(`href="[^"]*/(\d+)/"`)
+
+// Selector picks builds out of the history of a job. Zero-valued fields do not
+// restrict the selection.
+type Selector struct {
+	// Latest keeps only the N most recent builds.
+	Latest int
+
+	// Since and Until keep only the builds started within the interval.
+	Since, Until time.Time
+
+	// After keeps only the builds whose ID is greater than After.
+	After string
+}
+
+// Discover lists the builds of job and returns the IDs picked by sel, oldest
+// first. listing is either ListingGCSWeb or ListingGCS. The metadata fetched
+// to select builds by date is stored in c.
+func Discover(ctx context.Context, c *cache.Cache, job Job, listing string, sel Selector) ([]string, error) {
+	ids, err := Builds(job, listing)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel.After != "" {
+		after, err := strconv.ParseUint(sel.After, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build ID %q: %v", sel.After, err)
+		}
+		var newer []string
+		for _, id := range ids {
+			if n, _ := strconv.ParseUint(id, 10, 64); n > after {
+				newer = append(newer, id)
+			}
+		}
+		ids = newer
+	}
+
+	if !sel.Since.IsZero() || !sel.Until.IsZero() {
+		var inRange []string
+
+		// Build IDs grow over time, so walk backwards and stop at the
+		// first build older than the interval, or once the latest builds
+		// are found
+		for i := len(ids) - 1; i >= 0; i-- {
+			if sel.Latest > 0 && len(inRange) == sel.Latest {
+				break
+			}
+			started, err := getMetadata(ctx, c, job, ids[i], "started.json")
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				// Builds that never started, or were deleted, have no
+				// started.json
+				log.Printf("Skipping build %s of %s: %v", ids[i], job.Name, err)
+				continue
+			}
+			if !sel.Since.IsZero() && started.time.Before(sel.Since) {
+				break
+			}
+			if !sel.Until.IsZero() && started.time.After(sel.Until) {
+				continue
+			}
+			inRange = append([]string{ids[i]}, inRange...)
+		}
+		ids = inRange
+	}
+
+	if sel.Latest > 0 && len(ids) > sel.Latest {
+		ids = ids[len(ids)-sel.Latest:]
+	}
+
+	return ids, nil
+}
+
+// Builds returns the IDs of all the builds of job, oldest first.
+func Builds(job Job, listing string) ([]string, error) {
+	var (
+		ids []string
+		err error
+	)
+
+	switch listing {
+	case "", ListingGCSWeb:
+		ids, err = listGCSWeb(job)
+	case ListingGCS:
+		ids, err = listGCS(job)
+	default:
+		return nil, fmt.Errorf("unknown listing %q", listing)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list builds of %s: %v", job.Name, err)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseUint(ids[i], 10, 64)
+		b, _ := strconv.ParseUint(ids[j], 10, 64)
+		return a < b
+	})
+	return ids, nil
+}
+
+func listGCSWeb(job Job) ([]string, error) {
+	client := http.Client{Timeout: httpRequestTimeout}
+
+	res, err := client.Get(job.jobURL() + "/")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", res.Status)
+	}
+
+	page, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, match := range buildLink.FindAllSubmatch(page, -1) {
+		ids = append(ids, string(match[1]))
+	}
+	return ids, nil
+}
+
+func listGCS(job Job) ([]string, error) {
+	// The bucket is the last element of the gcsweb base URL
+	base, err := url.Parse(job.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	bucket := path.Base(base.Path)
+	prefix := job.jobPath() + "/"
+
+	client := http.Client{Timeout: httpRequestTimeout}
+	ids := []string{}
+	pageToken := ""
+	for {
+		query := url.Values{
+			"prefix":    {prefix},
+			"delimiter": {"/"},
+			"fields":    {"prefixes,nextPageToken"},
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		res, err := client.Get(gcsAPIURL + "/b/" + url.PathEscape(bucket) + "/o?" + query.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Prefixes      []string `json:"prefixes"`
+			NextPageToken string   `json:"nextPageToken"`
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("bad status: %s", res.Status)
+		}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range page.Prefixes {
+			id := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+			if _, err := strconv.ParseUint(id, 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+		}
+
+		if page.NextPageToken == "" {
+			return ids, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
@@ -0,0 +1,124 @@
+package prow
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
+)
+
+func TestDiscover(t *testing.T) {
+	const jobName = "release-openshift-ocp-installer-e2e-openstack-4.2"
+	jobPath := "/logs/" + jobName + "/"
+
+	// Builds start one hour apart, starting at 2019-10-01T00:00:00Z. The
+	// last one has no started.json
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	ids := []string{"9", "10", "11", "12", "13"}
+	var fetched int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == jobPath {
+			rw.Write([]byte(`<a href="/gcs/origin-ci-test/logs/">..</a>`))
+			for _, id := range ids {
+				fmt.Fprintf(rw, `<a href="/gcs/origin-ci-test%s%s/">%s/</a>`, jobPath, id, id)
+			}
+			fmt.Fprintf(rw, `<a href="/gcs/origin-ci-test%s14/">14/</a>`, jobPath)
+			return
+		}
+
+		if strings.HasSuffix(req.URL.Path, "/started.json") {
+			atomic.AddInt32(&fetched, 1)
+		}
+
+		for i, id := range ids {
+			if req.URL.Path == jobPath+id+"/started.json" {
+				fmt.Fprintf(rw, `{"timestamp":%d}`, start.Add(time.Duration(i)*time.Hour).Unix())
+				return
+			}
+		}
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	cachepath, err := ioutil.TempDir("", "prow-discover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachepath)
+
+	job := Job{Name: jobName, BaseURL: ts.URL}
+
+	for _, tc := range [...]struct {
+		name     string
+		selector Selector
+		expected []string
+
+		// fetched is the number of started.json requested
+		fetched int32
+	}{
+		{"latest", Selector{Latest: 2}, []string{"13", "14"}, 0},
+		{"after", Selector{After: "10"}, []string{"11", "12", "13", "14"}, 0},
+		{"since", Selector{Since: start.Add(150 * time.Minute)}, []string{"12", "13"}, 4},
+		{"between", Selector{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}, []string{"10", "11"}, 6},
+		{"combined", Selector{After: "9", Until: start.Add(3 * time.Hour), Latest: 2}, []string{"11", "12"}, 4},
+		{"until", Selector{Until: start.Add(3 * time.Hour), Latest: 1}, []string{"12"}, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&fetched, 0)
+			c := cache.New(filepath.Join(cachepath, tc.name), false)
+			have, err := Discover(context.Background(), c, job, ListingGCSWeb, tc.selector)
+			if err != nil {
+				t.Fatalf("while discovering builds: %v", err)
+			}
+			if !reflect.DeepEqual(have, tc.expected) {
+				t.Errorf("expected builds %v, found %v", tc.expected, have)
+			}
+			if n := atomic.LoadInt32(&fetched); n != tc.fetched {
+				t.Errorf("expected %d started.json to be fetched, found %d", tc.fetched, n)
+			}
+		})
+	}
+}
+
+func TestBuildsGCS(t *testing.T) {
+	const jobName = "release-openshift-ocp-installer-e2e-openstack-4.2"
+	prefix := "logs/" + jobName + "/"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/b/origin-ci-test/o" || req.URL.Query().Get("prefix") != prefix {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if req.URL.Query().Get("pageToken") == "" {
+			fmt.Fprintf(rw, `{"prefixes":["%s100/","%s99/"],"nextPageToken":"next"}`, prefix, prefix)
+			return
+		}
+		fmt.Fprintf(rw, `{"prefixes":["%slatest-build.txt/","%s101/"]}`, prefix, prefix)
+	}))
+	defer ts.Close()
+
+	defer func(u string) { gcsAPIURL = u }(gcsAPIURL)
+	gcsAPIURL = ts.URL
+
+	job := Job{Name: jobName, BaseURL: "https://gcsweb.example.com/gcs/origin-ci-test/"}
+	have, err := Builds(job, ListingGCS)
+	if err != nil {
+		t.Fatalf("while listing builds: %v", err)
+	}
+
+	if expected := []string{"99", "100", "101"}; !reflect.DeepEqual(have, expected) {
+		t.Errorf("expected builds %v, found %v", expected, have)
+	}
+}
@@ -0,0 +1,98 @@
+package prow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Deck is a client of the Prow Deck frontend.
+type Deck struct {
+	// URL is the root of Deck, e.g. "https://prow.svc.ci.openshift.org".
+	URL string
+
+	Client *http.Client
+}
+
+// DeckQuery selects prowjobs. Zero-valued fields select every prowjob.
+type DeckQuery struct {
+	// Job keeps only the jobs whose name matches.
+	Job *regexp.Regexp
+
+	// Type keeps only the jobs of the given type, e.g. "periodic".
+	Type string
+
+	// State keeps only the jobs in the given state, e.g. "failure".
+	State string
+
+	// Since keeps only the jobs started after the given time.
+	Since time.Time
+}
+
+// NewDeck creates a client of the Deck served at url.
+func NewDeck(url string) *Deck {
+	return &Deck{
+		URL:    strings.TrimSuffix(url, "/"),
+		Client: &http.Client{Timeout: httpRequestTimeout},
+	}
+}
+
+// ProwJobs returns all the prowjobs known to Deck.
+func (d *Deck) ProwJobs() ([]ProwJob, error) {
+	url := d.URL + "/prowjobs.js?omit=annotations,labels,decoration_config,pod_spec"
+	res, err := d.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status fetching %s: %s", url, res.Status)
+	}
+
+	var list struct {
+		Items []ProwJob `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", url, err)
+	}
+	return list.Items, nil
+}
+
+// Builds returns the completed prowjobs selected by q, oldest first.
+func (d *Deck) Builds(q DeckQuery) ([]ProwJob, error) {
+	all, err := d.ProwJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	builds := []ProwJob{}
+	for _, pj := range all {
+		// Running jobs have no artifacts yet
+		if pj.Status.CompletionTime.IsZero() || pj.Status.BuildID == "" {
+			continue
+		}
+		if q.Job != nil && !q.Job.MatchString(pj.Spec.Job) {
+			continue
+		}
+		if q.Type != "" && q.Type != pj.Spec.Type {
+			continue
+		}
+		if q.State != "" && !strings.EqualFold(q.State, pj.Status.State) {
+			continue
+		}
+		if pj.Status.StartTime.Before(q.Since) {
+			continue
+		}
+		builds = append(builds, pj)
+	}
+
+	sort.SliceStable(builds, func(i, j int) bool {
+		return builds[i].Status.StartTime.Before(builds[j].Status.StartTime)
+	})
+	return builds, nil
+}
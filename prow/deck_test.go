@@ -0,0 +1,45 @@
+package prow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDeckBuilds(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/prowjobs.js" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		rw.Write([]byte(`{"items":[
+{"spec":{"type":"periodic","job":"release-openshift-ocp-installer-e2e-openstack-4.3"},"status":{"state":"failure","startTime":"2019-10-01T14:00:00Z","completionTime":"2019-10-01T15:30:00Z","build_id":"12"}},
+{"spec":{"type":"periodic","job":"release-openshift-ocp-installer-e2e-openstack-4.3"},"status":{"state":"success","startTime":"2019-10-01T12:00:00Z","completionTime":"2019-10-01T13:30:00Z","build_id":"11"}},
+{"spec":{"type":"periodic","job":"release-openshift-ocp-installer-e2e-openstack-4.3"},"status":{"state":"failure","startTime":"2019-10-01T10:00:00Z","completionTime":"2019-10-01T11:30:00Z","build_id":"10"}},
+{"spec":{"type":"periodic","job":"release-openshift-ocp-installer-e2e-openstack-4.3"},"status":{"state":"failure","startTime":"2019-09-29T10:00:00Z","completionTime":"2019-09-29T11:30:00Z","build_id":"9"}},
+{"spec":{"type":"periodic","job":"release-openshift-ocp-installer-e2e-openstack-4.3"},"status":{"state":"pending","startTime":"2019-10-01T16:00:00Z","build_id":"13"}},
+{"spec":{"type":"periodic","job":"release-openshift-ocp-installer-e2e-aws-4.3"},"status":{"state":"failure","startTime":"2019-10-01T10:00:00Z","completionTime":"2019-10-01T11:30:00Z","build_id":"200"}}
+]}`))
+	}))
+	defer ts.Close()
+
+	builds, err := NewDeck(ts.URL).Builds(DeckQuery{
+		Job:   regexp.MustCompile("openstack"),
+		State: "failure",
+		Since: time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("while querying deck: %v", err)
+	}
+
+	have := []string{}
+	for _, pj := range builds {
+		have = append(have, pj.Status.BuildID)
+	}
+	if len(have) != 2 || have[0] != "10" || have[1] != "12" {
+		t.Errorf("expected builds [10 12], found %v", have)
+	}
+}
@@ -0,0 +1,48 @@
+package prow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter rejects builds based on their metadata, before their Prometheus data
+// is downloaded. Zero-valued fields accept every build.
+type Filter struct {
+	// Result keeps only the builds with the given result, e.g. "FAILURE".
+	Result string
+
+	// JobVersion keeps only the builds whose job version matches.
+	JobVersion *regexp.Regexp
+
+	// MinDuration keeps only the builds that ran at least this long.
+	MinDuration time.Duration
+}
+
+// SkipError is returned by Metrics when a build is rejected by a Filter.
+type SkipError struct {
+	JobID  string
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("skipped build %s: %s", e.JobID, e.Reason)
+}
+
+// check returns why m is rejected, or an empty string if it is accepted.
+func (f Filter) check(m MetricsData) string {
+	if f.Result != "" && !strings.EqualFold(f.Result, m.Result) {
+		return fmt.Sprintf("result is %q, want %q", m.Result, f.Result)
+	}
+
+	if f.JobVersion != nil && !f.JobVersion.MatchString(m.JobVersion) {
+		return fmt.Sprintf("job version %q does not match %q", m.JobVersion, f.JobVersion)
+	}
+
+	if duration := m.FinishedAt.Sub(m.StartedAt); duration < f.MinDuration {
+		return fmt.Sprintf("ran for %v, want at least %v", duration, f.MinDuration)
+	}
+
+	return ""
+}
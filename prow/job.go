@@ -0,0 +1,76 @@
+package prow
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	// JobTypePeriodic is the type of jobs storing their builds under
+	// "logs/<job>"
+	JobTypePeriodic = "periodic"
+
+	// JobTypePresubmit is the type of jobs storing their builds under
+	// "pr-logs/pull/<org>_<repo>/<pr>/<job>"
+	JobTypePresubmit = "presubmit"
+)
+
+// Job describes where the artifacts of a Prow job are stored.
+type Job struct {
+	// Name of the Prow job.
+	Name string
+
+	// Type is either JobTypePeriodic or JobTypePresubmit. Empty means
+	// periodic.
+	Type string
+
+	// Org, Repo and PR locate the pull request a presubmit job tested.
+	Org, Repo string
+	PR        int
+
+	// BaseURL is the root of the bucket holding the job logs.
+	BaseURL string
+
+	// ArtifactPath is a template for the location of the Prometheus tarball,
+	// relative to the build directory. It can reference {{.Job}} and {{.ID}}.
+	ArtifactPath string
+}
+
+// jobPath returns the path of the directory holding the builds of the job,
+// relative to the bucket.
+func (j Job) jobPath() string {
+	if j.Type == JobTypePresubmit {
+		return fmt.Sprintf("pr-logs/pull/%s_%s/%d/%s", j.Org, j.Repo, j.PR, j.Name)
+	}
+	return "logs/" + j.Name
+}
+
+// jobURL returns the URL of the directory holding the builds of the job.
+func (j Job) jobURL() string {
+	return strings.TrimSuffix(j.BaseURL, "/") + "/" + j.jobPath()
+}
+
+// buildURL returns the URL of the directory holding the artifacts of the
+// build jobID.
+func (j Job) buildURL(jobID string) string {
+	return j.jobURL() + "/" + jobID
+}
+
+// artifactPath returns the location of the Prometheus tarball of the build
+// jobID, relative to the build directory.
+func (j Job) artifactPath(jobID string) (string, error) {
+	tmpl, err := template.New(j.Name).Parse(j.ArtifactPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact path %q: %v", j.ArtifactPath, err)
+	}
+
+	var path bytes.Buffer
+	err = tmpl.Execute(&path, struct{ Job, ID string }{j.Name, jobID})
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact path %q: %v", j.ArtifactPath, err)
+	}
+
+	return strings.TrimPrefix(path.String(), "/"), nil
+}
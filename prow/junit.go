@@ -0,0 +1,189 @@
+package prow
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
+)
+
+// junitLink matches the links to JUnit files in a gcsweb listing.
+var junitLink = regexp.MustCompile(`href="([^"]*\.xml)"`)
+
+// TestCase is a test case parsed from a JUnit file.
+type TestCase struct {
+	Suite string
+	Name  string
+
+	// Start is when the test case started. It is zero if the JUnit file
+	// does not tell.
+	Start    time.Time
+	Duration time.Duration
+
+	Failed  bool
+	Message string
+}
+
+type junitSuites struct {
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string          `xml:"name,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+	Suites    []junitSuite    `xml:"testsuite"`
+}
+
+type junitTestCase struct {
+	Name      string  `xml:"name,attr"`
+	Timestamp string  `xml:"timestamp,attr"`
+	Time      float64 `xml:"time,attr"`
+	Failure   *struct {
+		Message string `xml:"message,attr"`
+	} `xml:"failure"`
+	Error *struct {
+		Message string `xml:"message,attr"`
+	} `xml:"error"`
+}
+
+// JUnit fetches and parses the JUnit files of the build jobID found in the
+// directory junitPath, relative to the build directory.
+func JUnit(ctx context.Context, c *cache.Cache, job Job, jobID, junitPath string) ([]TestCase, error) {
+	dirURL := job.buildURL(jobID) + "/" + strings.Trim(junitPath, "/")
+
+	files, err := listJUnit(ctx, dirURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list JUnit files in %s: %v", dirURL, err)
+	}
+
+	cases := []TestCase{}
+	for _, file := range files {
+		key := job.Name + "/" + jobID + "/" + strings.Trim(junitPath, "/") + "/" + file
+		p, err := c.Get(ctx, key, dirURL+"/"+file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %v", file, err)
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := parseJUnit(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+		cases = append(cases, parsed...)
+	}
+
+	return cases, nil
+}
+
+func listJUnit(ctx context.Context, dirURL string) ([]string, error) {
+	client := http.Client{Timeout: httpRequestTimeout}
+
+	req, err := http.NewRequest("GET", dirURL+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", res.Status)
+	}
+
+	page, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, match := range junitLink.FindAllSubmatch(page, -1) {
+		files = append(files, path.Base(string(match[1])))
+	}
+	return files, nil
+}
+
+// parseJUnit parses a JUnit file, whose root is either <testsuites> or
+// <testsuite>.
+func parseJUnit(data []byte) ([]TestCase, error) {
+	var suites junitSuites
+	err := xml.Unmarshal(data, &suites)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single <testsuite> root does not unmarshal into the list
+	if len(suites.Suites) == 0 {
+		var suite junitSuite
+		if err := xml.Unmarshal(data, &suite); err != nil {
+			return nil, err
+		}
+		suites.Suites = []junitSuite{suite}
+	}
+
+	cases := []TestCase{}
+	for _, suite := range suites.Suites {
+		cases = append(cases, suite.testCases()...)
+	}
+	return cases, nil
+}
+
+// testCases flattens the test cases of the suite and its nested suites. Test
+// cases with no timestamp of their own are assumed to run one after the other
+// from the start of the suite.
+func (s junitSuite) testCases() []TestCase {
+	cases := []TestCase{}
+	next := parseTimestamp(s.Timestamp)
+
+	for _, tc := range s.Cases {
+		c := TestCase{
+			Suite:    s.Name,
+			Name:     tc.Name,
+			Start:    parseTimestamp(tc.Timestamp),
+			Duration: time.Duration(tc.Time * float64(time.Second)),
+		}
+		if c.Start.IsZero() {
+			c.Start = next
+		}
+		if !next.IsZero() {
+			next = c.Start.Add(c.Duration)
+		}
+
+		switch {
+		case tc.Failure != nil:
+			c.Failed, c.Message = true, tc.Failure.Message
+		case tc.Error != nil:
+			c.Failed, c.Message = true, tc.Error.Message
+		}
+		cases = append(cases, c)
+	}
+
+	for _, nested := range s.Suites {
+		cases = append(cases, nested.testCases()...)
+	}
+	return cases
+}
+
+// parseTimestamp parses JUnit timestamps, which usually have no time zone.
+// It returns the zero time if the timestamp can not be parsed.
+func parseTimestamp(timestamp string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t.In(time.UTC)
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,53 @@
+package prow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJUnit(t *testing.T) {
+	data := []byte(`<testsuites>
+<testsuite name="openshift-tests" timestamp="2019-10-01T10:00:00">
+<testcase name="first" time="60"></testcase>
+<testcase name="second" time="30"><failure message="timed out"></failure></testcase>
+<testcase name="third" timestamp="2019-10-01T11:00:00" time="10"><error message="crashed"></error></testcase>
+</testsuite>
+</testsuites>`)
+
+	cases, err := parseJUnit(data)
+	if err != nil {
+		t.Fatalf("while parsing: %v", err)
+	}
+	if len(cases) != 3 {
+		t.Fatalf("expected 3 test cases, got %d", len(cases))
+	}
+
+	second := cases[1]
+	if !second.Failed || second.Message != "timed out" {
+		t.Errorf("expected the second test to fail with \"timed out\", got %+v", second)
+	}
+	if want := time.Date(2019, 10, 1, 10, 1, 0, 0, time.UTC); !second.Start.Equal(want) {
+		t.Errorf("expected the second test to start at %v, got %v", want, second.Start)
+	}
+
+	third := cases[2]
+	if !third.Failed || third.Message != "crashed" {
+		t.Errorf("expected the third test to fail with \"crashed\", got %+v", third)
+	}
+	if want := time.Date(2019, 10, 1, 11, 0, 0, 0, time.UTC); !third.Start.Equal(want) {
+		t.Errorf("expected the third test to start at %v, got %v", want, third.Start)
+	}
+}
+
+func TestParseJUnitSingleSuite(t *testing.T) {
+	cases, err := parseJUnit([]byte(`<testsuite name="e2e"><testcase name="only" time="1.5"></testcase></testsuite>`))
+	if err != nil {
+		t.Fatalf("while parsing: %v", err)
+	}
+	if len(cases) != 1 || cases[0].Suite != "e2e" || cases[0].Failed {
+		t.Fatalf("unexpected test cases: %+v", cases)
+	}
+	if !cases[0].Start.IsZero() {
+		t.Errorf("expected no start time without a suite timestamp, got %v", cases[0].Start)
+	}
+}
@@ -1,22 +1,38 @@
 package prow
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
 )
 
 // metadata contains the data parsed from "started.json" or "finished.json".
 type metadata struct {
-	time   time.Time
-	result string
+	time          time.Time
+	result        string
+	passed        bool
+	jobVersion    string
+	pod           string
+	workNamespace string
 }
 
 // UnmarshalJSON implements json.Unmarshal for metadata. The purpose of this
 // method is to parse a time.Time out of an epoch timestamp.
 func (m *metadata) UnmarshalJSON(src []byte) error {
 	var data struct {
-		Timestamp int64
-		Result    string
+		Timestamp  int64
+		Result     string
+		Passed     bool
+		JobVersion string `json:"job-version"`
+		Metadata   struct {
+			JobVersion    string `json:"job-version"`
+			Pod           string
+			WorkNamespace string `json:"work-namespace"`
+		}
 	}
 	err := json.Unmarshal(src, &data)
 	if err != nil {
@@ -25,10 +41,43 @@ func (m *metadata) UnmarshalJSON(src []byte) error {
 
 	t := time.Unix(data.Timestamp, 0)
 
+	// Older jobs record the version at the top level
+	jobVersion := data.Metadata.JobVersion
+	if jobVersion == "" {
+		jobVersion = data.JobVersion
+	}
+
 	*m = metadata{
-		time:   t.In(time.UTC),
-		result: data.Result,
+		time:          t.In(time.UTC),
+		result:        data.Result,
+		passed:        data.Passed,
+		jobVersion:    jobVersion,
+		pod:           data.Metadata.Pod,
+		workNamespace: data.Metadata.WorkNamespace,
 	}
 
 	return nil
 }
+
+// getMetadata fetches and parses "started.json" or "finished.json" of the
+// build jobID through the cache.
+func getMetadata(ctx context.Context, c *cache.Cache, job Job, jobID, file string) (metadata, error) {
+	var m metadata
+
+	url := job.buildURL(jobID) + "/" + file
+	path, err := c.Get(ctx, job.Name+"/"+jobID+"/"+file, url)
+	if err != nil {
+		return m, fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("failed to parse %s: %v", url, err)
+	}
+
+	return m, nil
+}
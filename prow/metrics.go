@@ -1,111 +1,113 @@
 package prow
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
 	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
 )
 
+// MetricsData holds the metadata of a build and the location of its
+// Prometheus tarball.
 type MetricsData struct {
 	StartedAt  time.Time
 	FinishedAt time.Time
 	PromFile   string
+
+	// Result is the outcome recorded by Prow, e.g. "SUCCESS" or "FAILURE".
+	Result string
+	Passed bool
+
+	// JobVersion is the version of the release under test.
+	JobVersion string
+
+	// Payload is the pod that ran the job, named after the release payload.
+	Payload string
+
+	WorkNamespace string
+
+	// BaseRef and BaseSHA are the branch and the commit a presubmit ran
+	// against. PR, PRSHA and Author describe the pull request it tested.
+	BaseRef string
+	BaseSHA string
+	PR      int
+	PRSHA   string
+	Author  string
 }
 
-// Metrics returns an io.ReadCloser that streams the tarball containing the
-// Prometheus data. It is the caller responsibility to call Close on the
-// returned MetricsData.
-func Metrics(baseURL, jobName, jobID, tarpath string) (MetricsData, error) {
-	var (
-		m      MetricsData
-		client http.Client
-	)
+// Metrics fetches the metadata of the build jobID and downloads the tarball
+// containing its Prometheus data into the cache. If filter rejects the build,
+// the tarball is not downloaded and a *SkipError is returned along with the
+// metadata.
+func Metrics(ctx context.Context, c *cache.Cache, job Job, jobID string, filter Filter) (MetricsData, error) {
+	var m MetricsData
 
 	// Get start metadata
 	{
-		req, err := http.NewRequest("GET", baseURL+"/"+jobName+"/"+jobID+"/started.json", nil)
-		if err != nil {
-			return m, err
-		}
-
-		res, err := client.Do(req)
+		started, err := getMetadata(ctx, c, job, jobID, "started.json")
 		if err != nil {
 			return m, err
 		}
 
-		var started metadata
-		if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
-			return m, err
-		}
-
 		m.StartedAt = started.time
 	}
 
 	// Get finish metadata
 	{
-		req, err := http.NewRequest("GET", baseURL+"/"+jobName+"/"+jobID+"/finished.json", nil)
+		finished, err := getMetadata(ctx, c, job, jobID, "finished.json")
 		if err != nil {
 			return m, err
 		}
 
-		res, err := client.Do(req)
+		m.FinishedAt = finished.time
+		m.Result = finished.result
+		m.Passed = finished.passed
+		m.JobVersion = finished.jobVersion
+		m.Payload = finished.pod
+		m.WorkNamespace = finished.workNamespace
+	}
+
+	// Get the refs a presubmit tested
+	if job.Type == JobTypePresubmit {
+		url := job.buildURL(jobID) + "/prowjob.json"
+		path, err := c.Get(ctx, job.Name+"/"+jobID+"/prowjob.json", url)
 		if err != nil {
-			return m, err
+			return m, fmt.Errorf("failed to fetch %s: %v", url, err)
 		}
 
-		var finished metadata
-		if err := json.NewDecoder(res.Body).Decode(&finished); err != nil {
+		pj, err := ReadProwJob(path)
+		if err != nil {
 			return m, err
 		}
 
-		m.FinishedAt = finished.time
-		// how to get success/fail
-		//	m.Result = finished.result
+		if refs := pj.Spec.Refs; refs != nil {
+			m.BaseRef, m.BaseSHA = refs.BaseRef, refs.BaseSHA
+			if len(refs.Pulls) > 0 {
+				m.PR = refs.Pulls[0].Number
+				m.PRSHA = refs.Pulls[0].SHA
+				m.Author = refs.Pulls[0].Author
+			}
+		}
+	}
+
+	if reason := filter.check(m); reason != "" {
+		return m, &SkipError{JobID: jobID, Reason: reason}
 	}
 
 	// Get Tarball
 	{
-		m.PromFile = filepath.Join(tarpath, "/prometheus.tar")
-		err := downloadFile(m.PromFile, baseURL+"/"+jobName+"/"+jobID+"/artifacts/e2e-openstack/metrics/prometheus.tar")
+		artifactPath, err := job.artifactPath(jobID)
+		if err != nil {
+			return m, err
+		}
+
+		key := job.Name + "/" + jobID + "/" + artifactPath
+		m.PromFile, err = c.Get(ctx, key, job.buildURL(jobID)+"/"+artifactPath)
 		if err != nil {
 			return m, fmt.Errorf("Failed to downlad tarball: %v", err)
 		}
 	}
 
 	return m, nil
-
-}
-
-func downloadFile(filepath string, url string) error {
-
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// Check server response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
-
-	// Writer the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
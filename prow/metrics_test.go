@@ -2,19 +2,23 @@ package prow
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
 )
 
-// const baseURL = "https://gcsweb-ci.svc.ci.openshift.org/gcs/origin-ci-test/logs/"
+// const baseURL = "https://gcsweb-ci.svc.ci.openshift.org/gcs/origin-ci-test"
 
-// WARN BROKEN
 func TestMetrics(t *testing.T) {
-	baseURL := "/release-openshift-ocp-installer-e2e-openstack-4.2/16"
+	baseURL := "/logs/release-openshift-ocp-installer-e2e-openstack-4.2/16"
 	tarball := []byte("This text represents the binary tarball.")
 	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		log.Println("path:", req.URL.Path)
@@ -37,16 +41,38 @@ func TestMetrics(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	data, err := Metrics(ts.URL, "release-openshift-ocp-installer-e2e-openstack-4.2", "16")
+	cachepath, err := ioutil.TempDir("", "prow-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachepath)
+
+	job := Job{
+		Name:         "release-openshift-ocp-installer-e2e-openstack-4.2",
+		BaseURL:      ts.URL,
+		ArtifactPath: "artifacts/e2e-openstack/metrics/prometheus.tar",
+	}
+	data, err := Metrics(context.Background(), cache.New(cachepath, false), job, "16", Filter{})
 	if err != nil {
 		t.Fatalf("while fetching the data: %v", err)
 	}
-	defer data.Close()
 
 	t.Run("Parses the build status", func(t *testing.T) {
 		if want := "FAILURE"; want != data.Result {
 			t.Errorf("expected result to be %q, found %q", want, data.Result)
 		}
+		if data.Passed {
+			t.Errorf("expected the build not to have passed")
+		}
+	})
+
+	t.Run("Parses the build metadata", func(t *testing.T) {
+		if want := "4.2.0-0.nightly-2019-10-01-124419-openstack"; want != data.Payload {
+			t.Errorf("expected payload to be %q, found %q", want, data.Payload)
+		}
+		if want := "ci-op-i281gs2x"; want != data.WorkNamespace {
+			t.Errorf("expected work namespace to be %q, found %q", want, data.WorkNamespace)
+		}
 	})
 
 	t.Run("Parses the build time", func(t *testing.T) {
@@ -70,7 +96,7 @@ func TestMetrics(t *testing.T) {
 	})
 
 	t.Run("Provides the Prometheus data", func(t *testing.T) {
-		have, err := ioutil.ReadAll(data)
+		have, err := ioutil.ReadFile(data.PromFile)
 		if err != nil {
 			t.Errorf("while reading the data: %v", err)
 		}
@@ -79,4 +105,69 @@ func TestMetrics(t *testing.T) {
 			t.Errorf("expected tarball to be %q, found %q", tarball, have)
 		}
 	})
+	t.Run("Skips the builds rejected by the filter", func(t *testing.T) {
+		skippath, err := ioutil.TempDir("", "prow-metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(skippath)
+
+		_, err = Metrics(context.Background(), cache.New(skippath, false), job, "16", Filter{Result: "SUCCESS"})
+		if _, ok := err.(*SkipError); !ok {
+			t.Fatalf("expected a SkipError, found %v", err)
+		}
+
+		tarball := filepath.Join(skippath, job.Name, "16", "artifacts/e2e-openstack/metrics/prometheus.tar")
+		if _, err := os.Stat(tarball); !os.IsNotExist(err) {
+			t.Errorf("expected the tarball not to be downloaded")
+		}
+	})
+}
+
+func TestMetricsPresubmit(t *testing.T) {
+	buildPath := "/pr-logs/pull/openshift_installer/2345/pull-ci-openshift-installer-master-e2e-openstack/678"
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+
+		case buildPath + "/started.json":
+			rw.Write([]byte(`{"timestamp":1569934191}`))
+
+		case buildPath + "/finished.json":
+			rw.Write([]byte(`{"timestamp":1569939439,"passed":true,"result":"SUCCESS"}`))
+
+		case buildPath + "/prowjob.json":
+			rw.Write([]byte(`{"spec":{"type":"presubmit","job":"pull-ci-openshift-installer-master-e2e-openstack","refs":{"org":"openshift","repo":"installer","base_ref":"master","base_sha":"abc123","pulls":[{"number":2345,"author":"someone","sha":"def456"}]}},"status":{"build_id":"678"}}`))
+
+		case buildPath + "/artifacts/e2e-openstack/metrics/prometheus.tar":
+			rw.Write([]byte("This text represents the binary tarball."))
+
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cachepath, err := ioutil.TempDir("", "prow-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachepath)
+
+	job := Job{
+		Name:         "pull-ci-openshift-installer-master-e2e-openstack",
+		Type:         JobTypePresubmit,
+		Org:          "openshift",
+		Repo:         "installer",
+		PR:           2345,
+		BaseURL:      ts.URL,
+		ArtifactPath: "artifacts/e2e-openstack/metrics/prometheus.tar",
+	}
+	data, err := Metrics(context.Background(), cache.New(cachepath, false), job, "678", Filter{})
+	if err != nil {
+		t.Fatalf("while fetching the data: %v", err)
+	}
+
+	if data.BaseSHA != "abc123" || data.PR != 2345 || data.PRSHA != "def456" || data.Author != "someone" {
+		t.Errorf("unexpected refs: base %q, PR %d at %q by %q", data.BaseSHA, data.PR, data.PRSHA, data.Author)
+	}
 }
@@ -0,0 +1,96 @@
+package prow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ProwJob holds the fields of a prowjob.json used to locate a build and to
+// describe what it tested.
+type ProwJob struct {
+	Spec struct {
+		Type string `json:"type"`
+		Job  string `json:"job"`
+		Refs *Refs  `json:"refs"`
+	} `json:"spec"`
+
+	Status struct {
+		State          string    `json:"state"`
+		StartTime      time.Time `json:"startTime"`
+		CompletionTime time.Time `json:"completionTime"`
+		URL            string    `json:"url"`
+		BuildID        string    `json:"build_id"`
+	} `json:"status"`
+}
+
+// Refs are the git references a job ran against.
+type Refs struct {
+	Org     string `json:"org"`
+	Repo    string `json:"repo"`
+	BaseRef string `json:"base_ref"`
+	BaseSHA string `json:"base_sha"`
+	Pulls   []Pull `json:"pulls"`
+}
+
+// Pull is a pull request merged into the base ref before testing.
+type Pull struct {
+	Number int    `json:"number"`
+	Author string `json:"author"`
+	SHA    string `json:"sha"`
+}
+
+// ReadProwJob parses the prowjob.json at location, which is either a URL or
+// a path on disk.
+func ReadProwJob(location string) (ProwJob, error) {
+	var (
+		pj ProwJob
+		r  io.ReadCloser
+	)
+
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := http.Client{Timeout: httpRequestTimeout}
+		res, err := client.Get(location)
+		if err != nil {
+			return pj, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return pj, fmt.Errorf("bad status fetching %s: %s", location, res.Status)
+		}
+		r = res.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return pj, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(&pj); err != nil {
+		return pj, fmt.Errorf("failed to parse %s: %v", location, err)
+	}
+	return pj, nil
+}
+
+// Job returns the Job the prowjob ran as, with its artifacts under baseURL.
+func (pj ProwJob) Job(baseURL, artifactPath string) Job {
+	job := Job{
+		Name:         pj.Spec.Job,
+		Type:         pj.Spec.Type,
+		BaseURL:      baseURL,
+		ArtifactPath: artifactPath,
+	}
+	if refs := pj.Spec.Refs; refs != nil {
+		job.Org, job.Repo = refs.Org, refs.Repo
+		if len(refs.Pulls) > 0 {
+			job.PR = refs.Pulls[0].Number
+		}
+	}
+	return job
+}
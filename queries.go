@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/frontend"
+	"github.com/shiftstack-dev-tools/prom-dashboard/prometheus"
+)
+
+// defaultQuantile is the quantile of the metrics listing none
+const defaultQuantile = 0.99
+
+// metricQuery is a PromQL query gathered for every test run
+type metricQuery struct {
+	// name is recorded in the Metric column of the results
+	name string
+
+	// metric is the value of {{.Metric}} in tmpl
+	metric string
+
+	// quantile is the value of {{.Quantile}} in tmpl. It is recorded in the
+	// Quantile column of the results unless it is 0, when the query lists
+	// no quantiles and gets defaultQuantile
+	quantile float64
+
+	tmpl *template.Template
+}
+
+// metricSpec is a metric of the config. Its query depends on its type,
+// which may only be known once the Prometheus of a test run is up
+type metricSpec struct {
+	frontend.Metric
+
+	// tmpl replaces the default query of the type, if set
+	tmpl *template.Template
+}
+
+// buildQueries parses the templates of the metrics and of the queries of the
+// config. Queries get one template per quantile, so that all the quantiles
+// are gathered from the same Prometheus instance
+func buildQueries(req *frontend.DataRequest) ([]metricSpec, []metricQuery, error) {
+	metrics := []metricSpec{}
+	for _, metric := range req.TimeSeries {
+		spec := metricSpec{Metric: metric}
+		if metric.Query != "" {
+			tmpl, err := prometheus.ParseQuery(metric.Name, metric.Query)
+			if err != nil {
+				return nil, nil, err
+			}
+			spec.tmpl = tmpl
+		}
+		metrics = append(metrics, spec)
+	}
+
+	queries := []metricQuery{}
+	for _, query := range req.Queries {
+		tmpl, err := prometheus.ParseQuery(query.Name, query.Query)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(query.Quantiles) == 0 {
+			queries = append(queries, metricQuery{name: query.Name, metric: query.Metric, tmpl: tmpl})
+		}
+		for _, quantile := range query.Quantiles {
+			queries = append(queries, metricQuery{name: query.Name, metric: query.Metric, quantile: quantile, tmpl: tmpl})
+		}
+	}
+	return metrics, queries, nil
+}
+
+// resolveQueries returns the queries of a test run: the ones of the metrics,
+// typed with metadata, followed by queries
+func resolveQueries(metrics []metricSpec, queries []metricQuery, metadata map[string][]prometheus.Metadata) ([]metricQuery, error) {
+	resolved := []metricQuery{}
+	for _, metric := range metrics {
+		typ, series := prometheus.Classify(metric.Name, metadata)
+		if metric.Type != "" {
+			typ, series = metric.Type, metric.Name
+			if typ == prometheus.TypeHistogram && !strings.HasSuffix(series, "_bucket") {
+				series += "_bucket"
+			}
+		}
+
+		tmpl := metric.tmpl
+		if tmpl == nil {
+			var err error
+			tmpl, err = prometheus.ParseQuery(metric.Name, prometheus.DefaultQueries[typ])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !prometheus.HasQuantiles(typ) {
+			resolved = append(resolved, metricQuery{name: metric.Name, metric: series, tmpl: tmpl})
+			continue
+		}
+		quantiles := metric.Quantiles
+		if len(quantiles) == 0 {
+			quantiles = []float64{defaultQuantile}
+		}
+		for _, quantile := range quantiles {
+			resolved = append(resolved, metricQuery{name: metric.Name, metric: series, quantile: quantile, tmpl: tmpl})
+		}
+	}
+	return append(resolved, queries...), nil
+}
+
+// quantileVar is the value of {{.Quantile}} in the template of q
+func (q metricQuery) quantileVar() float64 {
+	if q.quantile == 0 {
+		return defaultQuantile
+	}
+	return q.quantile
+}
+
+// quantileColumn formats the quantile of q for the results
+func (q metricQuery) quantileColumn() string {
+	if q.quantile == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(q.quantile, 'g', -1, 64)
+}
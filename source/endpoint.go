@@ -0,0 +1,34 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Endpoint queries a live Prometheus or Thanos instead of a TSDB. Nothing
+// is downloaded nor started
+type Endpoint struct {
+	Job, ID string
+
+	// URL is the root of the Prometheus API
+	URL string
+
+	// Client carries the credentials of the endpoint
+	Client *http.Client
+
+	// Start and End bound the queries
+	Start, End time.Time
+}
+
+// Name implements Source
+func (e *Endpoint) Name() (string, string) {
+	return e.Job, e.ID
+}
+
+// Fetch implements Source
+func (e *Endpoint) Fetch(ctx context.Context, dir string) (Run, error) {
+	run := Run{URL: e.URL, Client: e.Client}
+	run.StartedAt, run.FinishedAt = e.Start, e.End
+	return run, nil
+}
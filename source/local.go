@@ -0,0 +1,139 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tarball reads the Prometheus data from a tarball on disk, e.g. from a
+// must-gather
+type Tarball struct {
+	Job, ID string
+	Path    string
+
+	// Start and End bound the queries. When zero, they are read from the data
+	Start, End time.Time
+}
+
+// Name implements Source
+func (t *Tarball) Name() (string, string) {
+	return t.Job, t.ID
+}
+
+// Fetch implements Source
+func (t *Tarball) Fetch(ctx context.Context, dir string) (Run, error) {
+	run := Run{}
+	run.PromFile = t.Path
+
+	run, err := extract(ctx, run, dir)
+	if err != nil {
+		return run, err
+	}
+
+	return setRange(run, t.Start, t.End)
+}
+
+// Dir reads the Prometheus data from an extracted TSDB directory. Prometheus
+// runs on a snapshot of it, so the directory is never modified
+type Dir struct {
+	Job, ID string
+	Path    string
+
+	// Start and End bound the queries. When zero, they are read from the data
+	Start, End time.Time
+}
+
+// Name implements Source
+func (d *Dir) Name() (string, string) {
+	return d.Job, d.ID
+}
+
+// Fetch implements Source
+func (d *Dir) Fetch(ctx context.Context, dir string) (Run, error) {
+	run := Run{DataDir: d.Path}
+	if f, err := os.Stat(d.Path); err != nil {
+		return run, err
+	} else if !f.IsDir() {
+		return run, fmt.Errorf("%s is not a directory", d.Path)
+	}
+
+	err := validate(run)
+	if err != nil {
+		return run, err
+	}
+
+	run.DataDir = filepath.Join(dir, "/prometheus")
+	err = snapshot(ctx, d.Path, run.DataDir)
+	if err != nil {
+		return run, fmt.Errorf("couldnt snapshot %s: %v", d.Path, err)
+	}
+
+	return setRange(run, d.Start, d.End)
+}
+
+// snapshot recreates the TSDB directory src at dst. Prometheus never writes
+// to the files of a block, it replaces or deletes them, so those are
+// hard-linked. The WAL and the head chunks are appended to and truncated, so
+// those and any other file are copied, as are blocks on another filesystem
+func snapshot(ctx context.Context, src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		// The modes of the copies are relaxed for the Prometheus container,
+		// as extract does. Those of the links are the ones of the originals
+		if info.IsDir() {
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+			return os.Chmod(target, os.ModePerm)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		parts := strings.Split(rel, string(filepath.Separator))
+		if len(parts) > 1 && parts[0] != "wal" && parts[0] != "chunks_head" {
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, 0666)
+}
@@ -0,0 +1,54 @@
+package source
+
+import (
+	"context"
+	"log"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
+	"github.com/shiftstack-dev-tools/prom-dashboard/prow"
+)
+
+// Prow fetches the Prometheus data of a Prow build from its artifacts
+type Prow struct {
+	Cache  *cache.Cache
+	Job    prow.Job
+	ID     string
+	Filter prow.Filter
+
+	// JUnitPath is the directory holding the JUnit files of the build,
+	// relative to the build directory. The test cases are not fetched when
+	// it is empty
+	JUnitPath string
+}
+
+// Name implements Source
+func (p *Prow) Name() (string, string) {
+	return p.Job.Name, p.ID
+}
+
+// Fetch implements Source. Builds rejected by the filter return a
+// *prow.SkipError
+func (p *Prow) Fetch(ctx context.Context, dir string) (Run, error) {
+	data, err := prow.Metrics(ctx, p.Cache, p.Job, p.ID, p.Filter)
+	run := Run{MetricsData: data}
+	if err != nil {
+		return run, err
+	}
+
+	if p.JUnitPath != "" {
+		// Runs that failed early have no JUnit files; their metrics are
+		// still worth gathering
+		run.Tests, err = prow.JUnit(ctx, p.Cache, p.Job, p.ID, p.JUnitPath)
+		if err != nil {
+			log.Printf("No test cases for test %s of job %s: %v", p.ID, p.Job.Name, err)
+		}
+	}
+
+	run, err = extract(ctx, run, dir)
+	if err != nil {
+		return run, err
+	}
+
+	checkCoverage(run)
+	return run, nil
+}
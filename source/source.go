@@ -0,0 +1,146 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/prow"
+	"github.com/shiftstack-dev-tools/prom-dashboard/tsdb"
+)
+
+// Source provides the Prometheus data of a single test run
+type Source interface {
+	// Name returns the job and the test ID the run is recorded under
+	Name() (job, id string)
+
+	// Fetch makes the TSDB of the run available. dir is a directory
+	// reserved to the run that can hold downloaded and extracted files.
+	// Cancelling ctx interrupts the downloads and the extraction
+	Fetch(ctx context.Context, dir string) (Run, error)
+}
+
+// Run holds the metadata of a test run and the location of its TSDB
+type Run struct {
+	prow.MetricsData
+
+	// DataDir is the directory holding the TSDB
+	DataDir string
+
+	// URL is the Prometheus API serving the run, when it is queried live
+	// rather than from a TSDB. Client makes the requests to it
+	URL    string
+	Client *http.Client
+
+	// Tests are the test cases of the run, when they are known
+	Tests []prow.TestCase
+}
+
+// NoDataError is returned by Fetch when a run has no usable Prometheus data.
+// The Run returned along with it still holds the metadata of the run
+type NoDataError struct {
+	Reason string
+}
+
+func (e *NoDataError) Error() string {
+	return fmt.Sprintf("no usable Prometheus data: %s", e.Reason)
+}
+
+// Cleanup removes the data Fetch extracted or copied into dir. The TSDB a Dir
+// source snapshots is left alone
+func Cleanup(dir string) error {
+	return os.RemoveAll(filepath.Join(dir, "/prometheus"))
+}
+
+// extract untars the Prometheus tarball of run into dir, checks that it holds
+// data and makes it accessible to the Prometheus container
+func extract(ctx context.Context, run Run, dir string) (Run, error) {
+	_, err := os.Stat(run.PromFile)
+	if err != nil {
+		return run, err
+	}
+
+	run.DataDir = filepath.Join(dir, "/prometheus")
+	err = os.MkdirAll(run.DataDir, os.ModePerm)
+	if err != nil {
+		return run, fmt.Errorf("couldnt create dir: %v", err)
+	}
+
+	err = Untar(ctx, run.DataDir, run.PromFile)
+	if ctx.Err() != nil {
+		return run, ctx.Err()
+	}
+	if err != nil {
+		return run, &NoDataError{Reason: fmt.Sprintf("the tarball is corrupted: %v", err)}
+	}
+
+	err = validate(run)
+	if err != nil {
+		return run, err
+	}
+
+	// CHMOD all files in untar'd prom dir to 777
+	cmd := exec.Command("chmod", []string{
+		"-R",
+		"777",
+		run.DataDir,
+	}...)
+
+	msg, err := cmd.CombinedOutput()
+	if err != nil {
+		return run, fmt.Errorf("couldnt chmod prom data: %s: %v", msg, err)
+	}
+
+	return run, nil
+}
+
+// validate checks that the TSDB of run can be queried
+func validate(run Run) error {
+	report, err := tsdb.Inspect(run.DataDir)
+	if err != nil {
+		return &NoDataError{Reason: fmt.Sprintf("the TSDB is unreadable: %v", err)}
+	}
+	if problem := report.Problem(); problem != "" {
+		return &NoDataError{Reason: problem}
+	}
+	return nil
+}
+
+// checkCoverage logs how the TSDB of run fails to cover the time span of the
+// run, if it does
+func checkCoverage(run Run) {
+	report, err := tsdb.Inspect(run.DataDir)
+	if err != nil {
+		return
+	}
+	for _, problem := range report.Coverage(run.StartedAt, run.FinishedAt) {
+		log.Printf("Data of %s does not cover the run: %s", run.DataDir, problem)
+	}
+}
+
+// setRange sets the start and end of a run that has no metadata to the given
+// times or, when they are zero, to the span of the TSDB blocks
+func setRange(run Run, start, end time.Time) (Run, error) {
+	run.StartedAt, run.FinishedAt = start, end
+	if !start.IsZero() && !end.IsZero() {
+		checkCoverage(run)
+		return run, nil
+	}
+
+	blocksStart, blocksEnd, err := tsdb.Range(run.DataDir)
+	if err != nil {
+		return run, fmt.Errorf("set start and end, could not read them from the data: %v", err)
+	}
+	if start.IsZero() {
+		run.StartedAt = blocksStart
+	}
+	if end.IsZero() {
+		run.FinishedAt = blocksEnd
+	}
+	return run, nil
+}
@@ -0,0 +1,128 @@
+package source
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Blocks span from 2019-10-01T11:00:00Z to 2019-10-01T15:00:00Z
+	blocks := map[string]string{
+		"01A": `{"ulid":"01A","minTime":1569927600000,"maxTime":1569934800000,"version":1}`,
+		"01B": `{"ulid":"01B","minTime":1569934800000,"maxTime":1569942000000,"version":1}`,
+	}
+	for ulid, meta := range blocks {
+		if err := os.MkdirAll(filepath.Join(dir, ulid), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, ulid, "meta.json"), []byte(meta), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocksStart := time.Date(2019, 10, 1, 11, 0, 0, 0, time.UTC)
+	blocksEnd := time.Date(2019, 10, 1, 15, 0, 0, 0, time.UTC)
+	start := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 10, 1, 13, 0, 0, 0, time.UTC)
+
+	for _, tc := range [...]struct {
+		name                   string
+		start, end             time.Time
+		expectStart, expectEnd time.Time
+	}{
+		{"given", start, end, start, end},
+		{"no start", time.Time{}, end, blocksStart, end},
+		{"no end", start, time.Time{}, start, blocksEnd},
+		{"none", time.Time{}, time.Time{}, blocksStart, blocksEnd},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			run, err := setRange(Run{DataDir: dir}, tc.start, tc.end)
+			if err != nil {
+				t.Fatalf("while setting the range: %v", err)
+			}
+			if !run.StartedAt.Equal(tc.expectStart) || !run.FinishedAt.Equal(tc.expectEnd) {
+				t.Errorf("expected %v to %v, got %v to %v", tc.expectStart, tc.expectEnd, run.StartedAt, run.FinishedAt)
+			}
+		})
+	}
+
+	t.Run("no blocks", func(t *testing.T) {
+		empty, err := ioutil.TempDir("", "source")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(empty)
+
+		if _, err := setRange(Run{DataDir: empty}, start, time.Time{}); err == nil {
+			t.Errorf("expected an error without blocks to read the end from")
+		}
+	})
+}
+
+func TestDirSnapshot(t *testing.T) {
+	src, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"wal/00000000", "01A/chunks/000001"} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte{0x01}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &Dir{Path: src, Start: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC), End: time.Date(2019, 10, 1, 13, 0, 0, 0, time.UTC)}
+	run, err := d.Fetch(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("while fetching: %v", err)
+	}
+	if run.DataDir == src {
+		t.Fatalf("expected Prometheus to run on a snapshot")
+	}
+
+	stat := func(path string) os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	if !os.SameFile(stat(filepath.Join(src, "01A/chunks/000001")), stat(filepath.Join(run.DataDir, "01A/chunks/000001"))) {
+		t.Errorf("expected the chunks of the block to be hard-linked")
+	}
+
+	// Prometheus appends to the WAL
+	if err := ioutil.WriteFile(filepath.Join(run.DataDir, "wal/00000000"), []byte{0x01, 0x02}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if size := stat(filepath.Join(src, "wal/00000000")).Size(); size != 1 {
+		t.Errorf("expected the WAL of the directory to be left alone, it holds %d bytes", size)
+	}
+
+	if err := Cleanup(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "01A/chunks/000001")); err != nil {
+		t.Errorf("expected the directory to outlive the cleanup: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTar writes a tarball holding a file for each of names, or a directory
+// for the names ending with a slash, gzipped if compress is set
+func writeTar(t *testing.T, path string, compress bool, names ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		content := []byte(name)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if compress {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = gz.Bytes()
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUntar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range [...]struct {
+		name     string
+		compress bool
+		entries  []string
+		valid    bool
+	}{
+		{"plain", false, []string{"prometheus/", "prometheus/wal/", "prometheus/wal/00000000"}, true},
+		{"gzipped", true, []string{"prometheus/", "prometheus/wal/", "prometheus/wal/00000000"}, true},
+		{"parent", false, []string{"../escaped"}, false},
+		{"nested parent", true, []string{"prometheus/../../escaped"}, false},
+		{"sibling prefix", false, []string{"../dst-escaped"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tarball := filepath.Join(dir, tc.name+".tar")
+			writeTar(t, tarball, tc.compress, tc.entries...)
+			dst := filepath.Join(dir, tc.name, "dst")
+			if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Untar(context.Background(), dst, tarball)
+			if !tc.valid {
+				if err == nil {
+					t.Fatalf("expected %v to be rejected", tc.entries)
+				}
+				if _, err := os.Stat(filepath.Join(dir, tc.name, "escaped")); !os.IsNotExist(err) {
+					t.Errorf("expected nothing to be written out of the destination, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("while extracting: %v", err)
+			}
+			for _, entry := range tc.entries {
+				if strings.HasSuffix(entry, "/") {
+					continue
+				}
+				content, err := ioutil.ReadFile(filepath.Join(dst, entry))
+				if err != nil {
+					t.Fatalf("while reading %s: %v", entry, err)
+				}
+				if string(content) != entry {
+					t.Errorf("expected %s to hold %q, got %q", entry, entry, content)
+				}
+			}
+		})
+	}
+}
+
+func TestUntarCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarball := filepath.Join(dir, "prometheus.tar")
+	writeTar(t, tarball, false, "prometheus/wal/00000000")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Untar(ctx, dir, tarball); err != context.Canceled {
+		t.Errorf("expected the extraction to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/shiftstack-dev-tools/prom-dashboard/cache"
+)
+
+// URL downloads the Prometheus tarball from a plain HTTP(S) URL
+type URL struct {
+	Cache   *cache.Cache
+	Job, ID string
+	URL     string
+
+	// Start and End bound the queries. When zero, they are read from the data
+	Start, End time.Time
+}
+
+// Name implements Source
+func (u *URL) Name() (string, string) {
+	return u.Job, u.ID
+}
+
+// Fetch implements Source
+func (u *URL) Fetch(ctx context.Context, dir string) (Run, error) {
+	run := Run{}
+
+	// URLs carry no job or build, key them by their hash
+	key := fmt.Sprintf("urls/%x/prometheus.tar", sha256.Sum256([]byte(u.URL)))
+	promFile, err := u.Cache.Get(ctx, key, u.URL)
+	if err != nil {
+		return run, fmt.Errorf("Failed to download tarball: %v", err)
+	}
+	run.PromFile = promFile
+
+	run, err = extract(ctx, run, dir)
+	if err != nil {
+		return run, err
+	}
+
+	return setRange(run, u.Start, u.End)
+}
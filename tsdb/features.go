@@ -0,0 +1,130 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// indexMagic starts the index file of every block
+	indexMagic = 0xBAAAD700
+
+	// legacyWALMagic starts the segments of the WAL written before
+	// Prometheus 2.4
+	legacyWALMagic = 0x43AF00EF
+
+	// walCompressionMask flags the compressed records of the WAL, which
+	// Prometheus writes since 2.11 when --storage.tsdb.wal-compression is set
+	walCompressionMask = 0x18
+)
+
+// Features are the on-disk formats used by a TSDB, which determine the
+// Prometheus versions able to read it
+type Features struct {
+	// MetaVersion is the highest version of the meta.json of the blocks
+	MetaVersion int
+
+	// IndexVersion is the highest format version of the index of the blocks
+	IndexVersion int
+
+	// LegacyWAL is set if the WAL predates Prometheus 2.4
+	LegacyWAL bool
+
+	// WALCompression is set if the WAL holds compressed records
+	WALCompression bool
+}
+
+// DetectFeatures inspects the blocks and the WAL of the TSDB directory dir
+func DetectFeatures(dir string) (Features, error) {
+	var f Features
+
+	blocks, err := Blocks(dir)
+	if err != nil {
+		return f, err
+	}
+	for _, block := range blocks {
+		if block.Version > f.MetaVersion {
+			f.MetaVersion = block.Version
+		}
+
+		version, err := indexVersion(filepath.Join(dir, block.ULID, "index"))
+		if err != nil {
+			return f, err
+		}
+		if version > f.IndexVersion {
+			f.IndexVersion = version
+		}
+	}
+
+	err = f.detectWAL(filepath.Join(dir, "wal"))
+	return f, err
+}
+
+// indexVersion reads the format version out of the header of an index file
+func indexVersion(path string) (int, error) {
+	header, err := readHeader(path, 5)
+	if err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(header) != indexMagic {
+		return 0, fmt.Errorf("%s is not a TSDB index", path)
+	}
+	return int(header[4]), nil
+}
+
+// detectWAL looks at the first record of the first WAL segment. A TSDB
+// without WAL has no WAL features
+func (f *Features) detectWAL(walDir string) error {
+	entries, err := ioutil.ReadDir(walDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	segments := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Size() > 0 {
+			segments = append(segments, entry.Name())
+		}
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+	sort.Strings(segments)
+
+	header, err := readHeader(filepath.Join(walDir, segments[0]), 4)
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(header) == legacyWALMagic {
+		f.LegacyWAL = true
+		return nil
+	}
+
+	// The first byte is the type of the record, with the compression flags
+	f.WALCompression = header[0]&walCompressionMask != 0
+	return nil
+}
+
+// readHeader reads the first n bytes of the file at path
+func readHeader(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, n)
+	_, err = io.ReadFull(file, header)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the header of %s: %v", path, err)
+	}
+	return header, nil
+}
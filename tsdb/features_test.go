@@ -0,0 +1,74 @@
+package tsdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectFeatures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "01A", "meta.json"), []byte(`{"ulid":"01A","minTime":0,"maxTime":1000,"version":1}`))
+	writeFile(t, filepath.Join(dir, "01A", "index"), []byte{0xBA, 0xAA, 0xD7, 0x00, 1})
+	writeFile(t, filepath.Join(dir, "01B", "meta.json"), []byte(`{"ulid":"01B","minTime":1000,"maxTime":2000,"version":1}`))
+	writeFile(t, filepath.Join(dir, "01B", "index"), []byte{0xBA, 0xAA, 0xD7, 0x00, 2})
+
+	// A full record of type series, snappy compressed
+	writeFile(t, filepath.Join(dir, "wal", "00000001"), []byte{0x09, 0x00, 0x10})
+	writeFile(t, filepath.Join(dir, "wal", "00000000"), []byte{0x01, 0x00, 0x10, 0x00})
+
+	f, err := DetectFeatures(dir)
+	if err != nil {
+		t.Fatalf("while detecting features: %v", err)
+	}
+
+	want := Features{MetaVersion: 1, IndexVersion: 2}
+	if f != want {
+		t.Errorf("expected %+v, got %+v", want, f)
+	}
+}
+
+func TestDetectFeaturesWAL(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		segment []byte
+		want    Features
+	}{
+		{"compressed", []byte{0x09, 0x00, 0x10, 0x00}, Features{WALCompression: true}},
+		{"legacy", []byte{0x43, 0xAF, 0x00, 0xEF}, Features{LegacyWAL: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tsdb")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			writeFile(t, filepath.Join(dir, "wal", "00000000"), tc.segment)
+
+			f, err := DetectFeatures(dir)
+			if err != nil {
+				t.Fatalf("while detecting features: %v", err)
+			}
+			if f != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, f)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// indexTOCLen is the size of the table of contents ending an index: the
+// offsets of its six sections, and a CRC32
+const indexTOCLen = 6*8 + 4
+
+// IndexStats are counted from the index of a block, rather than read from
+// its meta.json
+type IndexStats struct {
+	// Symbols is the number of distinct label names and values
+	Symbols int
+
+	// Series is the number of series the block holds
+	Series int
+
+	// LabelNames is the number of distinct label names
+	LabelNames int
+}
+
+// ReadIndexStats counts the symbols, the series and the label names of the
+// index file at path, in format version 1 or 2. Only the symbol table, the
+// postings offset table and the list of all the postings are read
+func ReadIndexStats(path string) (IndexStats, error) {
+	var stats IndexStats
+
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return stats, err
+	}
+	if info.Size() < 5+indexTOCLen {
+		return stats, fmt.Errorf("%s is too short to be a TSDB index", path)
+	}
+
+	header := make([]byte, 5)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return stats, err
+	}
+	if binary.BigEndian.Uint32(header) != indexMagic {
+		return stats, fmt.Errorf("%s is not a TSDB index", path)
+	}
+	if version := header[4]; version != 1 && version != 2 {
+		return stats, fmt.Errorf("unsupported index version %d in %s", version, path)
+	}
+
+	toc := make([]byte, indexTOCLen)
+	if _, err := f.ReadAt(toc, info.Size()-indexTOCLen); err != nil {
+		return stats, err
+	}
+	symbolsOffset := int64(binary.BigEndian.Uint64(toc[0:]))
+	postingsTableOffset := int64(binary.BigEndian.Uint64(toc[40:]))
+
+	// Sections start with their length and their number of entries
+	_, stats.Symbols, err = readSectionHeader(f, symbolsOffset)
+	if err != nil {
+		return stats, fmt.Errorf("invalid symbol table in %s: %v", path, err)
+	}
+
+	names, allPostings, err := readPostingsTable(f, postingsTableOffset)
+	if err != nil {
+		return stats, fmt.Errorf("invalid postings offset table in %s: %v", path, err)
+	}
+	stats.LabelNames = len(names)
+
+	_, stats.Series, err = readSectionHeader(f, allPostings)
+	if err != nil {
+		return stats, fmt.Errorf("invalid postings in %s: %v", path, err)
+	}
+	return stats, nil
+}
+
+// readSectionHeader reads the length in bytes and the number of entries
+// starting the section at offset
+func readSectionHeader(r io.ReaderAt, offset int64) (length, entries int, err error) {
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf, offset); err != nil {
+		return 0, 0, err
+	}
+	return int(binary.BigEndian.Uint32(buf)), int(binary.BigEndian.Uint32(buf[4:])), nil
+}
+
+// readPostingsTable returns the label names of the postings offset table at
+// offset, and the offset of the list of all the postings, which is keyed by
+// an empty name and value
+func readPostingsTable(r io.ReaderAt, offset int64) (map[string]bool, int64, error) {
+	length, entries, err := readSectionHeader(r, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if length < 4 {
+		return nil, 0, fmt.Errorf("length %d is too short", length)
+	}
+
+	// The length counts the number of entries, read above
+	table := make([]byte, length-4)
+	if _, err := r.ReadAt(table, offset+8); err != nil {
+		return nil, 0, err
+	}
+
+	names := map[string]bool{}
+	allPostings := int64(-1)
+	d := decoder{buf: table}
+	for i := 0; i < entries; i++ {
+		if n := d.byte(); n != 2 {
+			return nil, 0, fmt.Errorf("entry %d has %d labels", i, n)
+		}
+		name, value := d.string(), d.string()
+		postings := d.uvarint()
+		if d.err != nil {
+			return nil, 0, fmt.Errorf("entry %d: %v", i, d.err)
+		}
+
+		if name == "" && value == "" {
+			allPostings = int64(postings)
+			continue
+		}
+		names[name] = true
+	}
+	if allPostings < 0 {
+		return nil, 0, fmt.Errorf("no list of all the postings")
+	}
+	return names, allPostings, nil
+}
+
+// decoder reads the entries of an index section. The first error is kept,
+// and the following reads return zero values
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
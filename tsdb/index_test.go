@@ -0,0 +1,101 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeIndex writes an index holding series series, with every label name
+// in names set to a single value. Only the sections ReadIndexStats reads
+// are filled in, and the CRC32s are left empty
+func writeIndex(t *testing.T, path string, series int, names ...string) {
+	t.Helper()
+	buf := []byte{0xBA, 0xAA, 0xD7, 0x00, 2}
+	crc := []byte{0, 0, 0, 0}
+
+	symbols := len(buf)
+	buf = appendUint32(buf, 4)
+	buf = appendUint32(buf, uint32(2*len(names)))
+	buf = append(buf, crc...)
+
+	allPostings := len(buf)
+	buf = appendUint32(buf, uint32(4+4*series))
+	buf = appendUint32(buf, uint32(series))
+	for i := 0; i < series; i++ {
+		buf = appendUint32(buf, uint32(i))
+	}
+	buf = append(buf, crc...)
+
+	var entries []byte
+	for _, name := range append([]string{""}, names...) {
+		value := "v"
+		if name == "" {
+			value = ""
+		}
+		entries = append(entries, 2)
+		entries = appendString(entries, name)
+		entries = appendString(entries, value)
+		entries = appendUvarint(entries, uint64(allPostings))
+	}
+	postingsTable := len(buf)
+	buf = appendUint32(buf, uint32(4+len(entries)))
+	buf = appendUint32(buf, uint32(1+len(names)))
+	buf = append(buf, entries...)
+	buf = append(buf, crc...)
+
+	for _, offset := range []int{symbols, 0, 0, 0, allPostings, postingsTable} {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(offset))
+		buf = append(buf, b...)
+	}
+	buf = append(buf, crc...)
+
+	writeFile(t, path, buf)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return append(buf, b...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return append(buf, b[:binary.PutUvarint(b, v)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(appendUvarint(buf, uint64(len(s))), s...)
+}
+
+func TestReadIndexStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "index")
+	writeIndex(t, path, 3, "__name__", "job", "instance")
+	stats, err := ReadIndexStats(path)
+	if err != nil {
+		t.Fatalf("while reading the index: %v", err)
+	}
+	want := IndexStats{Symbols: 6, Series: 3, LabelNames: 3}
+	if stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+
+	// Only the header, as written by TestDetectFeatures
+	writeFile(t, path, []byte{0xBA, 0xAA, 0xD7, 0x00, 2})
+	if _, err := ReadIndexStats(path); err == nil {
+		t.Errorf("expected a truncated index to be rejected")
+	}
+
+	if _, err := ReadIndexStats(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected a missing index to be rejected")
+	}
+}
@@ -0,0 +1,234 @@
+package tsdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report describes the content of a TSDB directory
+type Report struct {
+	Dir string
+
+	// Blocks are sorted by start time
+	Blocks []BlockReport
+
+	WAL WALReport
+}
+
+// BlockReport describes a single block
+type BlockReport struct {
+	BlockMeta
+
+	// Size is the size of the block on disk, in bytes
+	Size int64
+
+	// Index holds the counts read from the index of the block, unless
+	// IndexError is set
+	Index      IndexStats
+	IndexError error
+}
+
+// WALReport describes the write-ahead log, which holds the samples not yet
+// compacted into a block
+type WALReport struct {
+	// Segments is the number of non-empty segments; First and Last are the
+	// numbers of the first and last ones
+	Segments    int
+	First, Last int
+
+	// Size is the size of the segments, in bytes
+	Size int64
+
+	// Checkpoint is the name of the latest checkpoint, if any
+	Checkpoint string
+}
+
+// Gap is an interval no block covers
+type Gap struct {
+	Start, End time.Time
+}
+
+// Inspect reads the metadata and the index of the blocks, and the WAL of the
+// TSDB directory dir. An unreadable index is reported by Problem rather than
+// returned
+func Inspect(dir string) (Report, error) {
+	r := Report{Dir: dir}
+
+	metas, err := Blocks(dir)
+	if err != nil {
+		return r, err
+	}
+	for _, meta := range metas {
+		size, err := dirSize(filepath.Join(dir, meta.ULID))
+		if err != nil {
+			return r, err
+		}
+		block := BlockReport{BlockMeta: meta, Size: size}
+		block.Index, block.IndexError = ReadIndexStats(filepath.Join(dir, meta.ULID, "index"))
+		r.Blocks = append(r.Blocks, block)
+	}
+	sort.Slice(r.Blocks, func(i, j int) bool {
+		return r.Blocks[i].MinTime < r.Blocks[j].MinTime
+	})
+
+	r.WAL, err = inspectWAL(filepath.Join(dir, "wal"))
+	return r, err
+}
+
+// Mismatch returns how the counts of the meta.json of the block disagree with
+// its index, or an empty string if they agree or the index is unreadable
+func (b BlockReport) Mismatch() string {
+	if b.IndexError != nil || b.Stats.NumSeries == uint64(b.Index.Series) {
+		return ""
+	}
+	return fmt.Sprintf("meta.json records %d series, the index holds %d", b.Stats.NumSeries, b.Index.Series)
+}
+
+func inspectWAL(walDir string) (WALReport, error) {
+	w := WALReport{}
+
+	entries, err := ioutil.ReadDir(walDir)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return w, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), "checkpoint.") && entry.Name() > w.Checkpoint {
+				w.Checkpoint = entry.Name()
+			}
+			continue
+		}
+		n, err := strconv.Atoi(entry.Name())
+		if err != nil || entry.Size() == 0 {
+			continue
+		}
+		if w.Segments == 0 || n < w.First {
+			w.First = n
+		}
+		if w.Segments == 0 || n > w.Last {
+			w.Last = n
+		}
+		w.Segments++
+		w.Size += entry.Size()
+	}
+	return w, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Start and End return the time span of the blocks
+func (r Report) Start() time.Time {
+	if len(r.Blocks) == 0 {
+		return time.Time{}
+	}
+	return MsToTime(r.Blocks[0].MinTime)
+}
+
+// End returns the end of the block that ends last
+func (r Report) End() time.Time {
+	var end int64
+	for _, block := range r.Blocks {
+		if block.MaxTime > end {
+			end = block.MaxTime
+		}
+	}
+	if end == 0 {
+		return time.Time{}
+	}
+	return MsToTime(end)
+}
+
+// Samples returns the number of samples in the blocks
+func (r Report) Samples() uint64 {
+	var samples uint64
+	for _, block := range r.Blocks {
+		samples += block.Stats.NumSamples
+	}
+	return samples
+}
+
+// Problem returns why the TSDB can not be queried, or an empty string if it
+// holds data
+func (r Report) Problem() string {
+	for _, block := range r.Blocks {
+		if block.IndexError != nil {
+			return fmt.Sprintf("the index of block %s is unreadable: %v", block.ULID, block.IndexError)
+		}
+	}
+
+	switch {
+	case len(r.Blocks) == 0 && r.WAL.Segments == 0:
+		return "the TSDB has neither blocks nor WAL"
+	case r.WAL.Segments == 0 && r.Samples() == 0:
+		return fmt.Sprintf("the %d blocks of the TSDB hold no samples and there is no WAL", len(r.Blocks))
+	}
+	return ""
+}
+
+// Gaps returns the intervals between the start of the first block and the
+// end of the last one that no block covers
+func (r Report) Gaps() []Gap {
+	gaps := []Gap{}
+	if len(r.Blocks) == 0 {
+		return gaps
+	}
+
+	covered := r.Blocks[0].MaxTime
+	for _, block := range r.Blocks[1:] {
+		if block.MinTime > covered {
+			gaps = append(gaps, Gap{Start: MsToTime(covered), End: MsToTime(block.MinTime)})
+		}
+		if block.MaxTime > covered {
+			covered = block.MaxTime
+		}
+	}
+	return gaps
+}
+
+// Coverage lists the ways the blocks fail to cover the interval from start
+// to end. The WAL usually holds the last couple of hours, so data missing at
+// the end is only reported when there is no WAL
+func (r Report) Coverage(start, end time.Time) []string {
+	problems := []string{}
+	if len(r.Blocks) == 0 {
+		if r.WAL.Segments > 0 {
+			return problems
+		}
+		return append(problems, "no blocks")
+	}
+
+	if r.Start().After(start) {
+		problems = append(problems, fmt.Sprintf("the blocks start at %s, %v after the start", r.Start(), r.Start().Sub(start)))
+	}
+	if r.WAL.Segments == 0 && r.End().Before(end) {
+		problems = append(problems, fmt.Sprintf("the blocks end at %s, %v before the end", r.End(), end.Sub(r.End())))
+	}
+	for _, gap := range r.Gaps() {
+		if gap.End.After(start) && gap.Start.Before(end) {
+			problems = append(problems, fmt.Sprintf("no block covers %s to %s", gap.Start, gap.End))
+		}
+	}
+	return problems
+}
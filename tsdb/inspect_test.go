@@ -0,0 +1,110 @@
+package tsdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two blocks with an hour missing in between
+	writeFile(t, filepath.Join(dir, "01B", "meta.json"), []byte(`{"ulid":"01B","minTime":1569938400000,"maxTime":1569945600000,"version":1,"stats":{"numSamples":20,"numSeries":2}}`))
+	writeFile(t, filepath.Join(dir, "01A", "meta.json"), []byte(`{"ulid":"01A","minTime":1569927600000,"maxTime":1569934800000,"version":1,"stats":{"numSamples":10,"numSeries":1}}`))
+	writeIndex(t, filepath.Join(dir, "01B", "index"), 2, "__name__", "job")
+	// The meta.json of 01A disagrees with its index
+	writeIndex(t, filepath.Join(dir, "01A", "index"), 3, "__name__")
+
+	r, err := Inspect(dir)
+	if err != nil {
+		t.Fatalf("while inspecting: %v", err)
+	}
+
+	if len(r.Blocks) != 2 || r.Blocks[0].ULID != "01A" {
+		t.Fatalf("expected the blocks sorted by start time, got %+v", r.Blocks)
+	}
+	if r.Blocks[1].Index != (IndexStats{Symbols: 4, Series: 2, LabelNames: 2}) {
+		t.Errorf("unexpected index of 01B: %+v", r.Blocks[1].Index)
+	}
+	if mismatch := r.Blocks[1].Mismatch(); mismatch != "" {
+		t.Errorf("expected the meta.json of 01B to match its index, got %q", mismatch)
+	}
+	if r.Blocks[0].Mismatch() == "" {
+		t.Errorf("expected the series of 01A to disagree with its index")
+	}
+	if r.Samples() != 30 {
+		t.Errorf("expected 30 samples, got %d", r.Samples())
+	}
+	if problem := r.Problem(); problem != "" {
+		t.Errorf("expected no problem, got %q", problem)
+	}
+
+	gaps := r.Gaps()
+	wantGap := Gap{Start: time.Date(2019, 10, 1, 13, 0, 0, 0, time.UTC), End: time.Date(2019, 10, 1, 14, 0, 0, 0, time.UTC)}
+	if len(gaps) != 1 || !gaps[0].Start.Equal(wantGap.Start) || !gaps[0].End.Equal(wantGap.End) {
+		t.Errorf("expected gap %+v, got %+v", wantGap, gaps)
+	}
+
+	// The run ends after the last block, and there is no WAL
+	problems := r.Coverage(time.Date(2019, 10, 1, 11, 30, 0, 0, time.UTC), time.Date(2019, 10, 1, 17, 0, 0, 0, time.UTC))
+	if len(problems) != 2 {
+		t.Errorf("expected the gap and the missing end to be reported, got %q", problems)
+	}
+}
+
+func TestInspectProblem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := Inspect(dir)
+	if err != nil {
+		t.Fatalf("while inspecting: %v", err)
+	}
+	if r.Problem() == "" {
+		t.Errorf("expected an empty TSDB to be reported")
+	}
+
+	writeFile(t, filepath.Join(dir, "wal", "00000003"), []byte{0x01})
+	r, err = Inspect(dir)
+	if err != nil {
+		t.Fatalf("while inspecting: %v", err)
+	}
+	if problem := r.Problem(); problem != "" {
+		t.Errorf("expected a TSDB with a WAL to be usable, got %q", problem)
+	}
+	if r.WAL.Segments != 1 || r.WAL.First != 3 || r.WAL.Last != 3 {
+		t.Errorf("unexpected WAL report: %+v", r.WAL)
+	}
+}
+
+func TestInspectUnreadableIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "01A", "meta.json"), []byte(`{"ulid":"01A","minTime":1569927600000,"maxTime":1569934800000,"version":1,"stats":{"numSamples":10,"numSeries":1}}`))
+	writeFile(t, filepath.Join(dir, "wal", "00000000"), []byte{0x01})
+
+	r, err := Inspect(dir)
+	if err != nil {
+		t.Fatalf("while inspecting: %v", err)
+	}
+	if r.Blocks[0].IndexError == nil {
+		t.Errorf("expected the missing index to be reported")
+	}
+	if r.Problem() == "" {
+		t.Errorf("expected a block without an index to make the TSDB unusable")
+	}
+}
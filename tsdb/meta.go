@@ -0,0 +1,87 @@
+package tsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlockMeta is the content of the meta.json file of a TSDB block
+type BlockMeta struct {
+	ULID    string `json:"ulid"`
+	MinTime int64  `json:"minTime"`
+	MaxTime int64  `json:"maxTime"`
+	Version int    `json:"version"`
+	Stats   struct {
+		NumSamples uint64 `json:"numSamples"`
+		NumSeries  uint64 `json:"numSeries"`
+		NumChunks  uint64 `json:"numChunks"`
+	} `json:"stats"`
+}
+
+// Blocks reads the meta.json of every block in the TSDB directory dir
+func Blocks(dir string) ([]BlockMeta, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []BlockMeta{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		metaFile := filepath.Join(dir, entry.Name(), "meta.json")
+		data, err := ioutil.ReadFile(metaFile)
+		if os.IsNotExist(err) {
+			// Not a block, e.g. the WAL
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var meta BlockMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("invalid block metadata %s: %v", metaFile, err)
+		}
+		blocks = append(blocks, meta)
+	}
+
+	return blocks, nil
+}
+
+// Range returns the time span covered by the blocks of the TSDB directory dir.
+// Data that is still in the WAL is not accounted for.
+func Range(dir string) (time.Time, time.Time, error) {
+	var start, end time.Time
+
+	blocks, err := Blocks(dir)
+	if err != nil {
+		return start, end, err
+	}
+	if len(blocks) == 0 {
+		return start, end, fmt.Errorf("no blocks found in %s", dir)
+	}
+
+	minTime, maxTime := blocks[0].MinTime, blocks[0].MaxTime
+	for _, block := range blocks[1:] {
+		if block.MinTime < minTime {
+			minTime = block.MinTime
+		}
+		if block.MaxTime > maxTime {
+			maxTime = block.MaxTime
+		}
+	}
+
+	return MsToTime(minTime), MsToTime(maxTime), nil
+}
+
+// MsToTime converts a TSDB timestamp, in milliseconds, to a UTC time
+func MsToTime(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).In(time.UTC)
+}